@@ -1,26 +1,54 @@
 package cmd
 
 import (
+	"fmt"
+	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spagettikod/vsix/database"
 	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spagettikod/vsix/vscode"
 	"github.com/spf13/cobra"
 )
 
+var (
+	continueOnError  bool
+	includeUniversal bool
+	resume           bool
+	checksumManifest string
+	maxAssetSize     string
+	collection       string
+	collectionGroup  string
+	errorReport      string
+	addLimit         int
+)
+
 func init() {
 	dbAddCmd.Flags().StringVarP(&dbPath, "data", "d", ".", "path where downloaded extensions are stored [VSIX_DB_PATH]")
 	dbAddCmd.Flags().IntVar(&threads, "threads", 10, "number of simultaneous download threads")
 	dbAddCmd.Flags().StringSliceVar(&targetPlatforms, "platforms", []string{}, "comma-separated list to limit which target platforms to add")
+	dbAddCmd.Flags().StringSliceVar(&assetTypes, "assets", []string{}, "comma-separated list to limit which asset types to add, for example vsix,manifest")
+	dbAddCmd.Flags().StringVar(&maxAssetSize, "max-asset-size", "", "skip assets, except the VSIX package, larger than this size, for example 50MB")
 	dbAddCmd.Flags().BoolVar(&preRelease, "pre-release", false, "include pre-release versions, these are skipped by default")
+	dbAddCmd.Flags().BoolVar(&includeUniversal, "include-universal", false, "also add the universal platform when limiting platforms with --platforms")
+	dbAddCmd.Flags().StringVar(&collection, "collection", "", "also add the extensions listed in this extension list file")
+	dbAddCmd.Flags().StringVar(&collectionGroup, "group", "", "only add the extensions listed under this group in the collection")
+	dbAddCmd.Flags().IntVar(&addLimit, "limit", 0, "maximum number of identifiers to add, 0 adds all given identifiers")
+	dbAddCmd.Flags().StringVar(&runReport, "run-report", "", "write a JSON report of the outcome for each extension to this file [VSIX_RUN_REPORT]")
+	dbAddCmd.Flags().StringVar(&errorReport, "error-report", "", "write a JSON report of the extensions that failed, and why, to this file [VSIX_ERROR_REPORT]")
+	dbAddCmd.Flags().BoolVar(&continueOnError, "continue-on-error", true, "continue adding the remaining extensions if one fails")
+	dbAddCmd.Flags().StringVar(&checksumManifest, "checksum-manifest", "", "write a checksum manifest of the asset files of the given extensions to this file")
+	dbAddCmd.Flags().BoolVar(&resume, "resume", false, "skip extensions added by a previous, interrupted, run")
 	dbAddCmd.Flags().BoolVar(&force, "force", false, "download extension eventhough it already exists locally")
 	rootCmd.AddCommand(dbAddCmd)
 }
 
 var dbAddCmd = &cobra.Command{
-	Use:   "add <identifier...>",
+	Use:   "add [identifier...]",
 	Short: "Add extension(s) from Marketplace to local storage",
 	Long: `Add extension(s) from Marketplace to local storage
 
@@ -29,13 +57,73 @@ Once added, use the update command to keep the extension up to date with Marketp
 the serve-command to host your own Marketplace with the downloaded extensions.
 
 Multiple identifiers, separated by space, can be used to add multiple extensions at once.
+Use the limit-flag to only process the first identifiers given. By default all extensions
+are processed even if one fails, use --continue-on-error=false to stop at the first failure.
+The command exits with exit code 2 if any extension failed.
+Use run-report, or VSIX_RUN_REPORT, to write a JSON report with the number of added,
+skipped and failed versions for each processed extension. Use error-report, or
+VSIX_ERROR_REPORT, to write a JSON report with the unique identifier and error
+message of only the extensions that failed. The report is written, empty if nothing
+failed, even when the command exits with a non-zero exit code. Use it to retry the
+failed extensions:
+
+  $ vsix add --data extensions $(jq -r '.[].unique_id' failures.json)
+
+Use max-asset-size to skip assets larger than the given size, for example 50MB, to save
+space. Sizes are given in B, KB, MB or GB, where 1KB is 1024 bytes. The VSIX package is
+always downloaded, it is needed to install the extension, as are assets where Marketplace
+does not report the size. Skipped assets are logged and left out of the version metadata.
+
+Use checksum-manifest to write a JSON manifest with the size and SHA-256 checksum
+of each asset file of the given extensions once they have been added. See the
+db checksums-command for details.
+
+Collections
+-----------
+Use collection to add the extensions listed in an extension list file, see the
+validate-list-command for the format. Extensions in a list file can be listed under
+named groups, a line with the group name in brackets starts a group:
+
+  # go-dev.txt
+  [go]
+  golang.Go
+  [debugging]
+  ms-vscode.cpptools 1.20.5
+
+Use group together with collection to only add the extensions listed under that
+group. Extensions listed with a version are added in that version:
+
+  $ vsix add --data extensions --collection go-dev.txt --group go
+
+Resuming
+--------
+While running, add records each extension that has been completely added in the
+file .add_journal in the local storage. The file is removed when all extensions
+were added without errors. If add is interrupted, or some extensions failed, run
+the same command again with the resume-flag to skip the extensions recorded as
+added by the previous run.
 
 Target platforms
 ----------------
 By default all platform versions of an extension are added. You can limit which platforms
 to add by using the platforms-flag. This is a comma separated list of platforms. You can
-view available platforms for an extension by using the info-command. The
-universal-platform is always added, regardless of the platforms-flag.
+view available platforms for an extension by using the info-command or the
+platforms-command, which also lists all valid platforms. The groups alpine, darwin,
+linux and win32 expand to all platforms of the operating system. When the
+platforms-flag is given the universal-platform is only added if it is in the list
+or if the include-universal flag is set. Some extensions only publish a universal
+version besides a few platform specific ones, use include-universal to always get
+the universal version as a fallback.
+
+Asset types
+-----------
+By default all assets of a version, like the VSIX package, manifest, icons and
+changelog, are added. You can limit which assets to add by using the assets-flag.
+This is a comma separated list of asset types. Valid asset types are:
+` + strings.Join(vscode.AssetTypeNames(), ", ") + `
+
+Visual Studio Code needs at least the vsix and manifest asset types to be able
+to install an extension.
 
 Pre-releases
 ------------
@@ -52,25 +140,65 @@ pre-release-flag.
     $ vsix add --data extensions $(vsix search --limit 100)
 `,
 	DisableFlagsInUseLine: true,
-	Args:                  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	Args: func(cmd *cobra.Command, args []string) error {
+		if collection != "" {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
 		logger := log.With().Str("path", dbPath).Logger()
 		start := time.Now()
+		assets, err := vscode.ParseAssetTypes(assetTypes)
+		if err != nil {
+			return err
+		}
+		maxSize, err := parseSize(maxAssetSize)
+		if err != nil {
+			return err
+		}
+		targetPlatforms, err = vscode.ParseTargetPlatforms(targetPlatforms)
+		if err != nil {
+			return err
+		}
+		if includeUniversal && len(targetPlatforms) > 0 && !slices.Contains(targetPlatforms, vscode.PlatformUniversal) {
+			targetPlatforms = append(targetPlatforms, vscode.PlatformUniversal)
+		}
+		if collectionGroup != "" && collection == "" {
+			return fmt.Errorf("group can only be used together with collection")
+		}
+		requested := []marketplace.ExtensionRequest{}
+		for _, arg := range args {
+			requested = append(requested, marketplace.ExtensionRequest{UniqueID: arg})
+		}
+		if collection != "" {
+			ers, err := marketplace.ReadCollection(collection, collectionGroup)
+			if err != nil {
+				return fmt.Errorf("could not read collection: %w", err)
+			}
+			requested = append(requested, ers...)
+		}
 		db, err := database.OpenFs(dbPath, false)
 		if err != nil {
-			log.Fatal().Err(err).Str("data_root", dbPath).Msg("could not open folder")
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
 		}
 
+		if addLimit > 0 && len(requested) > addLimit {
+			logger.Info().Msgf("limiting to the first %v of %v identifiers", addLimit, len(requested))
+		}
+		requested = firstRequests(requested, addLimit)
+
 		extensionsToAdd := []marketplace.ExtensionRequest{}
-		for _, arg := range args {
-			er := marketplace.ExtensionRequest{
-				UniqueID:        arg,
-				TargetPlatforms: targetPlatforms,
-				PreRelease:      preRelease,
-			}
-			if ext, found := db.GetByUniqueID(false, arg); found {
+		for _, er := range requested {
+			er.TargetPlatforms = targetPlatforms
+			er.AssetTypes = assets
+			er.PreRelease = preRelease
+			er.Force = force
+			er.MaxAssetSize = maxSize
+			// a given version is added even if other versions of the extension exist
+			if ext, found := db.GetByUniqueID(false, er.UniqueID); found && er.Version == "" {
 				if slices.Compare(ext.Platforms(), targetPlatforms) == 0 {
-					logger.Info().Msgf("extension %v for the given platforms already exists", arg)
+					logger.Info().Msgf("extension %v for the given platforms already exists", er.UniqueID)
 					continue
 				}
 			}
@@ -78,11 +206,92 @@ pre-release-flag.
 		}
 		extensionsToAdd = marketplace.Deduplicate(extensionsToAdd)
 
-		fetchCount, errCount := fetchThreaded(db, extensionsToAdd, threads, logger)
+		j, err := openJournal(filepath.Join(dbPath, journalFilename), resume)
+		if err != nil {
+			return fmt.Errorf("could not open add journal: %w", err)
+		}
+		extensionsToAdd = slices.DeleteFunc(extensionsToAdd, func(er marketplace.ExtensionRequest) bool {
+			if j.Done(er.UniqueID) {
+				logger.Info().Msgf("extension %v was added by a previous run, skipping", er.UniqueID)
+				return true
+			}
+			return false
+		})
+
+		results := fetchThreaded(db, extensionsToAdd, threads, continueOnError, func(result FetchResult) {
+			if result.Err != nil {
+				return
+			}
+			if err := j.Record(result.UniqueID); err != nil {
+				logger.Err(err).Msg("could not record extension in add journal")
+			}
+		}, logger)
+		if err := j.Close(results.Errors() == 0 && len(results) == len(extensionsToAdd)); err != nil {
+			logger.Err(err).Msg("could not close add journal")
+		}
+		if results.Downloads() > 0 {
+			// let a running serve-command know it should reload
+			logger.Debug().Msg("notifying server")
+			if err := db.Modified(); err != nil {
+				logger.Err(err).Msg("could not notify server of added extensions")
+			}
+		}
+		if err := writeRunReport(results); err != nil {
+			return err
+		}
+		if p := EnvOrFlag("VSIX_ERROR_REPORT", errorReport); p != "" {
+			if err := results.WriteErrorReport(p); err != nil {
+				return fmt.Errorf("could not write error report: %w", err)
+			}
+		}
+		if checksumManifest != "" {
+			ids := []string{}
+			for _, er := range requested {
+				ids = append(ids, er.UniqueID)
+			}
+			if err := writeChecksumManifest(db, ids, checksumManifest); err != nil {
+				return fmt.Errorf("could not write checksum manifest: %w", err)
+			}
+		}
+		fetchCount, errCount := results.Downloads(), results.Errors()
 		if errCount > 0 {
-			logger.Error().Msgf("%v extensions were added and %v errors occured, command took %.3fs", fetchCount, errCount, time.Since(start).Seconds())
-		} else {
-			logger.Info().Msgf("%v extensions were added and %v errors occured, command took %.3fs", fetchCount, errCount, time.Since(start).Seconds())
+			return withExitCode(exitPartial, fmt.Errorf("%v versions were added and %v of %v extensions failed, command took %.3fs", fetchCount, errCount, len(extensionsToAdd), time.Since(start).Seconds()))
 		}
+		logger.Info().Msgf("%v versions were added from %v extensions, command took %.3fs", fetchCount, len(extensionsToAdd), time.Since(start).Seconds())
+		return nil
 	},
 }
+
+// firstRequests returns the first n requests, or all requests if n is zero or less.
+func firstRequests(ers []marketplace.ExtensionRequest, n int) []marketplace.ExtensionRequest {
+	if n > 0 && len(ers) > n {
+		return ers[:n]
+	}
+	return ers
+}
+
+// sizeUnits are the units accepted by parseSize, longest suffix first
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseSize parses a size like 50MB into bytes. The units B, KB, MB and GB are supported, case
+// is ignored and a number without unit is bytes. An empty string is zero.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	number, unit := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, u := range sizeUnits {
+		if n, found := strings.CutSuffix(number, u.suffix); found {
+			number, unit = strings.TrimSpace(n), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s, expected a number followed by B, KB, MB or GB", s)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"":      0,
+		"512":   512,
+		"10B":   10,
+		"2kb":   2048,
+		"50MB":  50 << 20,
+		"1 GB":  1 << 30,
+		" 3MB ": 3 << 20,
+	}
+	for s, expected := range tests {
+		if n, err := parseSize(s); err != nil || n != expected {
+			t.Errorf("%q: expected %v, got %v: %v", s, expected, n, err)
+		}
+	}
+	for _, s := range []string{"MB", "-1MB", "1TB", "1.5MB"} {
+		if _, err := parseSize(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestAssetTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		assetType vscode.AssetTypeKey
+		max       int64
+		expected  bool
+	}{
+		{vscode.IconsDefault, 0, false},
+		{vscode.IconsDefault, 100, false},
+		{vscode.IconsDefault, 99, true},
+		{vscode.VSIXPackage, 99, false},
+	}
+	for _, test := range tests {
+		a := vscode.Asset{Type: test.assetType, Source: srv.URL}
+		content, err := marketplace.OpenAsset(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, tooLarge := assetTooLarge(marketplace.ExtensionRequest{MaxAssetSize: test.max}, a, content)
+		content.Close()
+		if tooLarge != test.expected {
+			t.Errorf("%v with max %v: expected too large to be %v", test.assetType, test.max, test.expected)
+		}
+	}
+	// content of unknown size is never too large
+	if _, tooLarge := assetTooLarge(marketplace.ExtensionRequest{MaxAssetSize: 1}, vscode.Asset{Type: vscode.IconsDefault}, strings.NewReader("xx")); tooLarge {
+		t.Error("expected content of unknown size not to be too large")
+	}
+	// a file reused from the asset cache is sized by the file size
+	p := filepath.Join(t.TempDir(), "icon")
+	if err := os.WriteFile(p, []byte(strings.Repeat("x", 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if size, tooLarge := assetTooLarge(marketplace.ExtensionRequest{MaxAssetSize: 99}, vscode.Asset{Type: vscode.IconsDefault}, f); !tooLarge || size != 100 {
+		t.Errorf("expected the reused file of 100 bytes to be too large, got %v bytes", size)
+	}
+}
+
+func TestAddLimit(t *testing.T) {
+	ers := []marketplace.ExtensionRequest{}
+	for i := range 25 {
+		ers = append(ers, marketplace.ExtensionRequest{UniqueID: fmt.Sprintf("publisher.extension%v", i)})
+	}
+	// the default limit of add, not to be confused with the limit of search, adds all
+	if got := firstRequests(ers, addLimit); len(got) != 25 {
+		t.Errorf("expected all 25 identifiers with the default limit %v, got %v", addLimit, len(got))
+	}
+	if got := firstRequests(ers, 10); len(got) != 10 || got[9].UniqueID != "publisher.extension9" {
+		t.Errorf("expected the first 10 identifiers, got %v", got)
+	}
+}
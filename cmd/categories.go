@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	categoriesCmd.Flags().StringVarP(&dbPath, "data", "d", ".", "path where downloaded extensions are stored [VSIX_DB_PATH]")
+	rootCmd.AddCommand(categoriesCmd)
+}
+
+var categoriesCmd = &cobra.Command{
+	Use:   "categories",
+	Short: "List categories of extensions in the local storage",
+	Long: `List categories of extensions in the local storage.
+
+Lists the Marketplace categories, like Programming Languages or Themes, of the
+extensions in the local storage together with the number of extensions in each
+category. Categories with the most extensions are listed first. An extension can
+be in several categories.`,
+	Example:               "  $ vsix categories --data extensions",
+	Args:                  cobra.NoArgs,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		data := [][]string{}
+		for _, c := range countCategories(db.List(true)) {
+			data = append(data, []string{c.name, strconv.Itoa(c.count)})
+		}
+		renderTable([]string{"Category", "Extensions"}, data)
+		return nil
+	},
+}
+
+type categoryCount struct {
+	name  string
+	count int
+}
+
+// countCategories returns the categories of exts with the number of extensions in each, sorted by
+// count in descending order and then by name.
+func countCategories(exts []vscode.Extension) []categoryCount {
+	counts := map[string]int{}
+	for _, ext := range exts {
+		categories := slices.Clone(ext.Categories)
+		slices.Sort(categories)
+		for _, c := range slices.Compact(categories) {
+			counts[c]++
+		}
+	}
+	result := []categoryCount{}
+	for name, count := range counts {
+		result = append(result, categoryCount{name: name, count: count})
+	}
+	slices.SortFunc(result, func(a, b categoryCount) int {
+		if a.count != b.count {
+			return cmp.Compare(b.count, a.count)
+		}
+		return cmp.Compare(a.name, b.name)
+	})
+	return result
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestCountCategories(t *testing.T) {
+	exts := []vscode.Extension{
+		{Categories: []string{"Themes"}},
+		{Categories: []string{"Programming Languages", "Linters", "Programming Languages"}},
+		{Categories: []string{"Linters", "Formatters"}},
+		{},
+	}
+	expected := []categoryCount{
+		{name: "Linters", count: 2},
+		{name: "Formatters", count: 1},
+		{name: "Programming Languages", count: 1},
+		{name: "Themes", count: 1},
+	}
+	if got := countCategories(exts); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
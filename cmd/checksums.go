@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spagettikod/vsix/database"
+	"github.com/spf13/cobra"
+)
+
+var checksumOutput string
+
+func init() {
+	dbChecksumsCmd.Flags().StringVarP(&checksumOutput, "output", "o", "", "write the manifest to this file instead of stdout")
+	dbCmd.AddCommand(dbChecksumsCmd)
+}
+
+var dbChecksumsCmd = &cobra.Command{
+	Use:   "checksums [identifier...]",
+	Short: "Create a checksum manifest of the asset files in the local storage",
+	Long: `Create a checksum manifest of the asset files in the local storage.
+
+Writes a JSON manifest listing each asset file, with its path relative to the local
+storage, size and SHA-256 checksum. By default all extensions are included, give one or
+more unique identifiers to only include those extensions. Copies of the local storage
+can be verified against the manifest with the verify-command.`,
+	Example: `  $ vsix db checksums --data extensions --output checksums.json
+
+  $ vsix db checksums --data extensions golang.Go redhat.java`,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		exts, err := findExtensions(db, args, false)
+		if err != nil {
+			return err
+		}
+		sums, err := db.Checksums(exts...)
+		if err != nil {
+			return fmt.Errorf("could not compute checksums: %w", err)
+		}
+		if checksumOutput == "" {
+			return database.WriteChecksums(os.Stdout, sums)
+		}
+		return database.WriteChecksumsFile(checksumOutput, sums)
+	},
+}
+
+// writeChecksumManifest writes a checksum manifest of the extensions with the given unique
+// identifiers to path. The database is reloaded first to include recently added versions,
+// identifiers not found in the database are left out.
+func writeChecksumManifest(db *database.DB, identifiers []string, path string) error {
+	if err := db.Reload(); err != nil {
+		return err
+	}
+	exts, _ := findExtensions(db, identifiers, false)
+	if len(exts) == 0 {
+		return database.WriteChecksumsFile(path, []database.Checksum{})
+	}
+	sums, err := db.Checksums(exts...)
+	if err != nil {
+		return err
+	}
+	return database.WriteChecksumsFile(path, sums)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/cobra"
+)
+
+var coveragePlatforms []string
+
+func init() {
+	dbCoverageCmd.Flags().StringSliceVar(&coveragePlatforms, "platform", []string{}, "comma-separated list of target platforms to check for")
+	dbCmd.AddCommand(dbCoverageCmd)
+}
+
+var dbCoverageCmd = &cobra.Command{
+	Use:   "coverage --platform <platforms>",
+	Short: "List extensions missing target platforms in the local storage",
+	Long: `List extensions missing target platforms in the local storage.
+
+Lists the extensions where the latest version in the local storage is missing one or
+more of the target platforms given by the platform-flag, together with the platforms
+that are missing. Extensions with a universal version for their latest version work
+on all platforms and are never listed. The groups alpine, darwin, linux and win32 can
+be used to check for all platforms of an operating system.
+
+Use the add-command with the platforms-flag to add the missing platforms.`,
+	Example: `  $ vsix db coverage --data extensions --platform darwin-arm64
+
+  $ vsix db coverage --data extensions --platform linux,win32-x64`,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		platforms, err := vscode.ParseTargetPlatforms(coveragePlatforms)
+		if err != nil {
+			return err
+		}
+		if len(platforms) == 0 {
+			return errors.New("at least one platform must be given with the platform-flag")
+		}
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		data := [][]string{}
+		for _, ext := range db.List(true) {
+			if missing := missingPlatforms(ext, platforms); len(missing) > 0 {
+				data = append(data, []string{ext.UniqueID(), ext.LatestVersion(true), strings.Join(missing, ", ")})
+			}
+		}
+		renderTable([]string{"Unique ID", "Version", "Missing Platforms"}, data)
+		return nil
+	},
+}
+
+// missingPlatforms returns the platforms not found among the versions of the extension. Nothing
+// is missing if the extension has a universal version.
+func missingPlatforms(ext vscode.Extension, platforms []string) []string {
+	existing := ext.Platforms()
+	if slices.Contains(existing, vscode.PlatformUniversal) {
+		return []string{}
+	}
+	return slices.DeleteFunc(slices.Clone(platforms), func(p string) bool {
+		return slices.Contains(existing, p)
+	})
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestMissingPlatforms(t *testing.T) {
+	tests := []struct {
+		versions []vscode.Version
+		expected []string
+	}{
+		{
+			versions: []vscode.Version{{RawTargetPlatform: "linux-x64"}, {RawTargetPlatform: "darwin-x64"}},
+			expected: []string{"darwin-arm64"},
+		},
+		{
+			versions: []vscode.Version{{RawTargetPlatform: "linux-x64"}, {RawTargetPlatform: "darwin-arm64"}},
+			expected: []string{},
+		},
+		{
+			versions: []vscode.Version{{}},
+			expected: []string{},
+		},
+	}
+	for _, test := range tests {
+		missing := missingPlatforms(vscode.Extension{Versions: test.versions}, []string{"linux-x64", "darwin-arm64"})
+		if !slices.Equal(missing, test.expected) {
+			t.Errorf("expected missing platforms %v but got %v", test.expected, missing)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dbCmd.PersistentFlags().StringVarP(&dbPath, "data", "d", ".", "path where downloaded extensions are stored [VSIX_DB_PATH]")
+	rootCmd.AddCommand(dbCmd)
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintain the extensions in the local storage",
+	Long: `Maintain the extensions in the local storage.
+
+Sub-commands work on the local storage only and do not query Marketplace unless
+stated otherwise.`,
+	DisableFlagsInUseLine: true,
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dbCmd.AddCommand(dbInfoCmd)
+}
+
+var dbInfoCmd = &cobra.Command{
+	Use:   "info <identifier>",
+	Short: "Display information about an extension in the local storage",
+	Long: `Display information about an extension in the local storage.
+
+This command is the local storage counterpart of the info-command. Besides the
+basic information about the extension it lists every version and target platform
+in the local storage together with their asset files and sizes.`,
+	Example:               "  $ vsix db info --data extensions golang.Go",
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		ext, found := db.GetByUniqueID(false, args[0])
+		if !found {
+			return withExitCode(exitNotFound, fmt.Errorf("extension %s was not found in %s", args[0], dbPath))
+		}
+		s := `Name:                 %s
+Publisher:            %s
+Badges:               %s
+Latest version:       %s
+Installs:             %v
+Categories:           %s
+Tags:                 %s
+Last updated:         %s
+
+`
+		fmt.Printf(s,
+			ext.DisplayName,
+			ext.Publisher.DisplayName,
+			badges(ext),
+			ext.LatestVersion(true),
+			ext.InstallCount(),
+			strings.Join(ext.Categories, ", "),
+			strings.Join(ext.Tags, ", "),
+			ext.LastUpdated.Format("2006-01-02 15:04 UTC"))
+
+		data := [][]string{}
+		for _, v := range ext.Versions {
+			for _, a := range v.Files {
+				size := "-"
+				if n, err := db.AssetSize(a); err == nil {
+					size = fmt.Sprint(n)
+				}
+				data = append(data, []string{v.Version, v.TargetPlatform(), fmt.Sprint(v.IsPreRelease()), vscode.AssetTypeName(a.Type), size})
+			}
+		}
+		renderTable([]string{"Version", "Target Platform", "Pre-release", "Asset", "Size"}, data)
+		return nil
+	},
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import "errors"
+
+// Exit codes of vsix. Scripts can rely on these, changing them is a breaking change.
+const (
+	// exitSuccess is returned when the command succeeded
+	exitSuccess = 0
+	// exitFailure is returned on invalid usage or when the command failed
+	exitFailure = 1
+	// exitPartial is returned when the command ran to completion but some extensions, versions
+	// or assets failed, the rest were processed
+	exitPartial = 2
+	// exitNotFound is returned when extensions given to the command were not found
+	exitNotFound = 3
+)
+
+// exitError is returned by commands that need to exit with a specific exit code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode returns err as an exitError with the given exit code. Nil is returned if err is nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code for an error returned by a command, exitFailure unless the error
+// is, or wraps, an exitError.
+func exitCode(err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+	var ee exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitFailure
+}
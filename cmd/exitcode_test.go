@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	failure := errors.New("failure")
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{nil, exitSuccess},
+		{failure, exitFailure},
+		{withExitCode(exitPartial, failure), exitPartial},
+		{fmt.Errorf("wrapped: %w", withExitCode(exitNotFound, failure)), exitNotFound},
+		{errors.Join(withExitCode(exitNotFound, failure), failure), exitNotFound},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.err); got != test.expected {
+			t.Errorf("%v: expected exit code %v, got %v", test.err, test.expected, got)
+		}
+	}
+	if withExitCode(exitPartial, nil) != nil {
+		t.Error("expected nil error to stay nil")
+	}
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	db := removeTestDB(t)
+	defaultPath := dbPath
+	dbPath = db.Root()
+	defer func() { dbPath = defaultPath }()
+
+	// a version with an asset that is missing and has no source to download it from again
+	damaged := t.TempDir()
+	writeFixture(t, damaged, map[string]string{
+		"golang/go/_vsix_db_extension_metadata.json":         `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"golang/go/1.0.0/abc/_vsix_db_version_metadata.json": `{"version":"1.0.0","assetUri":"https://x/abc","files":[{"assetType":"Microsoft.VisualStudio.Services.Icons.Default"}]}`,
+	})
+	inDamaged := func(run func() error) func() error {
+		return func() error {
+			dbPath = damaged
+			defer func() { dbPath = db.Root() }()
+			return run()
+		}
+	}
+
+	tests := []struct {
+		name     string
+		run      func() error
+		expected int
+	}{
+		{"repair asset without source", inDamaged(func() error { return dbRepairCmd.RunE(dbRepairCmd, []string{}) }), exitPartial},
+		{"repair given extension without source", inDamaged(func() error { return dbRepairCmd.RunE(dbRepairCmd, []string{"golang.go"}) }), exitPartial},
+		{"repair unknown extension", inDamaged(func() error { return dbRepairCmd.RunE(dbRepairCmd, []string{"foo.bar"}) }), exitNotFound},
+		{"remove unknown extension", func() error { return dbRemoveCmd.RunE(dbRemoveCmd, []string{"foo.bar"}) }, exitNotFound},
+		{"move unknown extension", func() error { return dbMoveCmd.RunE(dbMoveCmd, []string{"foo.bar", "foo.baz"}) }, exitNotFound},
+		{"move to invalid identifier", func() error { return dbMoveCmd.RunE(dbMoveCmd, []string{"golang.go", "golang"}) }, exitFailure},
+		{"info of unknown extension", func() error { return dbInfoCmd.RunE(dbInfoCmd, []string{"foo.bar"}) }, exitNotFound},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.run()); got != test.expected {
+			t.Errorf("%s: expected exit code %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -32,12 +31,11 @@ which extentions the pack includes.
 	Example:               "  $ vsix info golang.Go",
 	Args:                  cobra.MinimumNArgs(1),
 	DisableFlagsInUseLine: true,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		log.Info().Str("identifier", args[0]).Msg("looking up extension at Marketplace")
 		ext, err := marketplace.FetchExtension(args[0])
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return err
 		}
 		s := `Name:                 %s
 Publisher:            %s
@@ -66,5 +64,6 @@ Extension pack:       %s
 			ext.LastUpdated.Format("2006-01-02 15:04 UTC"),
 			strings.Join(ext.ExtensionPack(), "\n                      "),
 			ext.ShortDescription)
+		return nil
 	},
 }
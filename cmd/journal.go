@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+)
+
+// journalFilename is the name of the add journal in the local storage
+const journalFilename = ".add_journal"
+
+// journal records the unique IDs of extensions that have been added, one per line, making it
+// possible to resume an interrupted add without fetching them again.
+type journal struct {
+	path string
+	done map[string]bool
+	f    *os.File
+}
+
+// openJournal opens the journal at path. If resume is true the extensions recorded by a previous
+// run are kept, otherwise the journal is emptied.
+func openJournal(path string, resume bool) (*journal, error) {
+	j := &journal{path: path, done: map[string]bool{}}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if resume {
+		f, err := os.Open(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if id := strings.TrimSpace(scanner.Text()); id != "" {
+					j.done[strings.ToLower(id)] = true
+				}
+			}
+			f.Close()
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.f = f
+	return j, nil
+}
+
+// Done returns true if the extension has been recorded as added.
+func (j *journal) Done(uniqueID string) bool {
+	return j.done[strings.ToLower(uniqueID)]
+}
+
+// Record records the extension as added.
+func (j *journal) Record(uniqueID string) error {
+	j.done[strings.ToLower(uniqueID)] = true
+	if _, err := j.f.WriteString(uniqueID + "\n"); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Close closes the journal, if remove is true the journal file is removed as well.
+func (j *journal) Close(remove bool) error {
+	if err := j.f.Close(); err != nil {
+		return err
+	}
+	if remove {
+		return os.Remove(j.path)
+	}
+	return nil
+}
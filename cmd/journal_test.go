@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalFilename)
+	j, err := openJournal(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Record("golang.Go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// resuming keeps recorded extensions
+	j, err = openJournal(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !j.Done("golang.go") {
+		t.Error("expected golang.go to be recorded as done")
+	}
+	if j.Done("redhat.java") {
+		t.Error("did not expect redhat.java to be recorded as done")
+	}
+	if err := j.Close(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// not resuming starts over
+	j, err = openJournal(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Done("golang.go") {
+		t.Error("expected journal to be emptied when not resuming")
+	}
+	if err := j.Close(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected journal to be removed, got %v", err)
+	}
+}
@@ -2,38 +2,182 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/vscode"
 	"github.com/spf13/cobra"
 )
 
+var (
+	matchFlag      string
+	snippet        bool
+	tags           []string
+	exact          bool
+	caseSensitive  bool
+	expanded       bool
+	preReleaseOnly bool
+	listSortBy     string
+	listSortOrder  string
+)
+
 func init() {
 	listCmd.Flags().StringVarP(&dbPath, "data", "d", ".", "path where downloaded extensions are stored [VSIX_DB_PATH]")
+	listCmd.Flags().StringVar(&matchFlag, "match", "any", "how multiple search terms are combined, valid values are: any, all")
+	listCmd.Flags().BoolVar(&exact, "exact", false, "only match search terms equal to a whole word")
+	listCmd.Flags().BoolVar(&caseSensitive, "case-sensitive", false, "only match search terms with the same case")
+	listCmd.Flags().BoolVar(&snippet, "snippet", false, "show an excerpt of where the search terms matched")
+	listCmd.Flags().BoolVar(&expanded, "platforms-expanded", false, "list one row for each target platform of the latest version")
+	listCmd.Flags().BoolVar(&preReleaseOnly, "prerelease-only", false, "only list extensions with pre-release versions, and only those versions")
+	listCmd.Flags().StringVarP(&listSortBy, "sort", "s", "none", "sort critera, valid values are: none, install, rating, date")
+	listCmd.Flags().StringVar(&listSortOrder, "sort-order", "", "sort order, valid values are: asc, desc, default is descending")
+	listCmd.Flags().StringSliceVar(&tags, "tag", []string{}, "only list extensions with the given tag, use multiple times or comma-separate to require several tags")
 	rootCmd.AddCommand(listCmd)
 }
 
 var listCmd = &cobra.Command{
-	Use:     "list",
+	Use:     "list [search terms...]",
 	Aliases: []string{"ls"},
 	Short:   "List extensions from the local storage",
 	Long: `List extensions from the local storage.
 	
-Command will list all extension with their unique identifier.`,
-	Example:               "  $ vsix list --data extensions",
+Command will list all extension with their unique identifier.
+
+Searching
+---------
+Search terms can be given to only list extensions where the name, display
+name, publisher or description contain the terms. By default extensions
+matching any of the terms are listed, use --match all to only list extensions
+matching all of the terms.
+
+Terms match anywhere in a word, searching for go also lists extensions
+mentioning golang or gofmt. Use --exact to only match whole words.
+
+Terms with hyphens or dots, like remote-ssh or ms-vscode-remote.remote-ssh,
+also match extensions where all of their parts can be found.
+
+Case is ignored by default, searching for Prettier also lists extensions
+mentioning prettier. Use --case-sensitive to only match terms with the same case.
+
+Use --snippet to show an excerpt of the description where the terms matched,
+matched terms are enclosed in brackets.
+
+Tags
+----
+Use --tag to only list extensions tagged with the given tag at Marketplace, for
+example keybindings or snippet. Tags are matched exactly, ignoring case. When
+several tags are given only extensions with all of them are listed.
+
+Target platforms
+----------------
+Use --platforms-expanded to list one row for each target platform stored for
+the latest version of the extensions. This makes it easy to spot extensions
+missing a platform, for example darwin-arm64.
+
+Sorting
+-------
+Extensions are listed in the order they are stored by default. Use --sort to sort
+them by install count, rating or published date, in descending order. Use
+--sort-order asc to reverse the order, for example to list the oldest extensions
+first.
+
+Pre-releases
+------------
+Use --prerelease-only to only list extensions with pre-release versions in the
+local storage. Combined with --platforms-expanded one row is listed for each
+stored pre-release version and target platform, instead of the latest version.
+
+Output
+------
+By default one unique identifier is listed per line, suitable for piping to other
+commands. When a table is listed, with --platforms-expanded or --snippet, a footer
+shows how many of the extensions in the local storage are listed.`,
+	Example: `  $ vsix list --data extensions
+
+  $ vsix list --data extensions --match all docker kubernetes
+
+  $ vsix list --data extensions --tag keybindings
+
+  $ vsix list --data extensions --sort date --sort-order asc
+
+  $ vsix list --data extensions --prerelease-only --platforms-expanded`,
 	DisableFlagsInUseLine: true,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		logger := log.With().Str("path", dbPath).Logger()
 		start := time.Now()
+		match, err := database.ParseMatch(matchFlag)
+		if err != nil {
+			return err
+		}
+		sortBy, err := parseSortCriteria(listSortBy)
+		if err != nil {
+			return err
+		}
+		sortOrder, err := parseSortOrder(listSortOrder)
+		if err != nil {
+			return err
+		}
 		db, err := database.OpenFs(dbPath, false)
 		if err != nil {
-			log.Fatal().Err(err).Str("data_root", dbPath).Msg("could not open folder")
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		// all versions are needed to find the pre-releases
+		keepLatestVersion := !preReleaseOnly
+		exts := db.List(keepLatestVersion)
+		if len(args) > 0 {
+			exts = db.SearchWithOptions(keepLatestVersion, database.SearchOptions{Match: match, Exact: exact, CaseSensitive: caseSensitive}, args...)
+		}
+		if preReleaseOnly {
+			exts = preReleases(exts)
 		}
-		exts := db.List(true)
-		for _, ext := range exts {
-			fmt.Printf("%s\n", ext.UniqueID())
+		exts = slices.DeleteFunc(exts, func(e vscode.Extension) bool {
+			for _, tag := range tags {
+				if !e.HasTag(tag) {
+					return true
+				}
+			}
+			return false
+		})
+		database.SortExtensions(exts, sortBy, sortOrder)
+		if expanded {
+			data := [][]string{}
+			for _, ext := range exts {
+				for _, v := range ext.Versions {
+					data = append(data, []string{ext.UniqueID(), v.Version, v.TargetPlatform()})
+				}
+			}
+			renderTable([]string{"Unique ID", "Version", "Target Platform"}, data)
+			fmt.Println(footer(len(exts), db.Stats().ExtensionCount))
+		} else if snippet && len(args) > 0 {
+			data := [][]string{}
+			for _, ext := range exts {
+				data = append(data, []string{ext.UniqueID(), database.Snippet(ext, 60, args...)})
+			}
+			renderTable([]string{"Unique ID", "Match"}, data)
+			fmt.Println(footer(len(exts), db.Stats().ExtensionCount))
+		} else {
+			for _, ext := range exts {
+				fmt.Printf("%s\n", ext.UniqueID())
+			}
 		}
 		logger.Debug().Msgf("total time for list %.3fs", time.Since(start).Seconds())
+		return nil
 	},
 }
+
+// preReleases returns the extensions with pre-release versions, keeping only their pre-release
+// versions.
+func preReleases(exts []vscode.Extension) []vscode.Extension {
+	result := []vscode.Extension{}
+	for _, ext := range exts {
+		ext.Versions = slices.DeleteFunc(slices.Clone(ext.Versions), func(v vscode.Version) bool {
+			return !v.IsPreRelease()
+		})
+		if len(ext.Versions) > 0 {
+			result = append(result, ext)
+		}
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestPreReleases(t *testing.T) {
+	preRelease := []vscode.Property{{Key: "Microsoft.VisualStudio.Code.PreRelease", Value: "true"}}
+	exts := []vscode.Extension{
+		{Name: "go", Publisher: vscode.Publisher{Name: "golang"}, Versions: []vscode.Version{
+			{Version: "2.0.0", Properties: preRelease},
+			{Version: "1.0.0"},
+		}},
+		{Name: "java", Publisher: vscode.Publisher{Name: "redhat"}, Versions: []vscode.Version{
+			{Version: "1.0.0"},
+		}},
+	}
+	result := preReleases(exts)
+	if len(result) != 1 || result[0].UniqueID() != "golang.go" {
+		t.Fatalf("expected only golang.go to have pre-releases, got %v", result)
+	}
+	if len(result[0].Versions) != 1 || result[0].Versions[0].Version != "2.0.0" {
+		t.Errorf("expected only the pre-release version to be kept, got %v", result[0].Versions)
+	}
+	if len(exts[0].Versions) != 2 {
+		t.Error("expected the given extensions to be left unchanged")
+	}
+}
+
+func TestListSortDefault(t *testing.T) {
+	// list and search have different default sort criteria, make sure they don't overwrite each other
+	if listSortBy != "none" {
+		t.Errorf("expected list to sort by none by default, got %v", listSortBy)
+	}
+	if sortByFlag != "install" {
+		t.Errorf("expected search to sort by install by default, got %v", sortByFlag)
+	}
+}
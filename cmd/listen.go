@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixAddrPrefix is the prefix of listen addresses that are unix socket paths
+const unixAddrPrefix = "unix:"
+
+// listen returns a listener for addr. Addresses starting with unix: are paths to a unix socket,
+// for example unix:/run/vsix.sock, all other addresses are TCP addresses like 0.0.0.0:8080 or
+// [::1]:8080. A socket file left behind by a previous run is removed before listening. The
+// socket file is removed when the listener is closed.
+func listen(addr string) (net.Listener, error) {
+	socket, isUnix := strings.CutPrefix(addr, unixAddrPrefix)
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+	if socket == "" {
+		return nil, fmt.Errorf("unix socket path missing in address %s", addr)
+	}
+	if fi, err := os.Stat(socket); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a unix socket", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, fmt.Errorf("could not remove old unix socket %s: %w", socket, err)
+		}
+	}
+	return net.Listen("unix", socket)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "vsix.sock")
+	// a socket file left behind by an earlier run must not stop the server from starting
+	for i := 0; i < 2; i++ {
+		ln, err := listen(unixAddrPrefix + socket)
+		if err != nil {
+			t.Fatalf("run %v: %v", i, err)
+		}
+		if ln.Addr().Network() != "unix" {
+			t.Fatalf("expected network unix, got %s", ln.Addr().Network())
+		}
+		if i == 0 {
+			// simulate a crash by not removing the socket file on close
+			ln.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+		}
+		if err := ln.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatalf("expected socket file to be removed, got %v", err)
+	}
+}
+
+func TestListenUnixNotSocket(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "vsix.sock")
+	if err := os.WriteFile(file, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(unixAddrPrefix + file); err == nil {
+		t.Fatal("expected error when address is a regular file")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("regular file should not be removed: %v", err)
+	}
+}
+
+func TestListenTCP(t *testing.T) {
+	ln, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().Network() != "tcp" {
+		t.Fatalf("expected network tcp, got %s", ln.Addr().Network())
+	}
+}
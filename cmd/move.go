@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/database"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dbMoveCmd.Flags().BoolVar(&dry, "dry", false, "execute command without actually moving anything")
+	dbCmd.AddCommand(dbMoveCmd)
+}
+
+var dbMoveCmd = &cobra.Command{
+	Use:     "move <identifier> <new identifier>",
+	Aliases: []string{"mv"},
+	Short:   "Move an extension to a new unique identifier",
+	Long: `Move an extension to a new unique identifier.
+
+When a publisher, or an extension, is renamed at Marketplace the extension gets a new
+unique identifier. This command moves an extension in the local storage, with all of its
+versions and assets, to the new unique identifier without downloading it again. Only the
+publisher name and extension name in the metadata are changed.
+
+The command fails if an extension with the new unique identifier already exists in the
+local storage. Unique identifiers are compared ignoring case.`,
+	Example:               "  $ vsix db move --data extensions oldpublisher.go newpublisher.go",
+	Args:                  cobra.ExactArgs(2),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.With().Str("path", dbPath).Str("command", "move").Logger()
+		start := time.Now()
+		publisher, name, found := strings.Cut(args[1], ".")
+		if !found || publisher == "" || name == "" || strings.Contains(name, ".") {
+			return fmt.Errorf("invalid unique identifier %s, expected publisher.name", args[1])
+		}
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		ext, found := db.GetByUniqueID(false, args[0])
+		if !found {
+			return withExitCode(exitNotFound, fmt.Errorf("extension %s was not found", args[0]))
+		}
+		if dry {
+			logger.Info().Str("extension", ext.UniqueID()).Str("destination", args[1]).Msg("would be moved without dry run")
+			return nil
+		}
+		if err := db.MoveExtension(ext, publisher, name); err != nil {
+			return fmt.Errorf("could not move %s: %w", ext.UniqueID(), err)
+		}
+		if err := db.Modified(); err != nil {
+			logger.Err(err).Msg("could not notify server of moved extension")
+		}
+		logger.Info().Msgf("moved %s to %s, command took %.3fs", ext.UniqueID(), args[1], time.Since(start).Seconds())
+		return nil
+	},
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/cobra"
+)
+
+var listPlatforms bool
+
+func init() {
+	platformsCmd.Flags().BoolVar(&listPlatforms, "list", false, "list all target platforms supported by Visual Studio Code")
+	rootCmd.AddCommand(platformsCmd)
+}
+
+var platformsCmd = &cobra.Command{
+	Use:   "platforms [identifier]",
+	Short: "List target platforms",
+	Long: `List target platforms.
+
+Without an identifier, or with the list-flag, all target platforms supported by
+Visual Studio Code are listed. These are the valid values for the platforms-flag
+of other commands. No request is made to Marketplace.
+
+The platforms-flag also accepts the groups alpine, darwin, linux and win32 which
+expand to all target platforms of the operating system, for example linux expands
+to linux-x64, linux-arm64 and linux-armhf.
+
+Given an identifier the target platforms available at Marketplace for the latest
+version of the extension are listed.`,
+	Example: `  $ vsix platforms
+
+  $ vsix platforms redhat.java`,
+	Args:                  cobra.MaximumNArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if listPlatforms || len(args) == 0 {
+			for _, p := range vscode.TargetPlatforms() {
+				fmt.Println(p)
+			}
+			return nil
+		}
+		log.Info().Str("identifier", args[0]).Msg("looking up extension at Marketplace")
+		ext, err := marketplace.FetchExtension(args[0])
+		if err != nil {
+			return err
+		}
+		versions, _ := ext.Version(ext.LatestVersion(false))
+		platforms := []string{}
+		for _, v := range versions {
+			platforms = append(platforms, v.TargetPlatform())
+		}
+		slices.Sort(platforms)
+		for _, p := range slices.Compact(platforms) {
+			fmt.Println(p)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spagettikod/vsix/vscode"
+)
+
+// servedExtensions decides which extensions in the local storage are exposed by serve, the zero
+// value exposes all extensions
+var servedExtensions servePolicy
+
+// servePolicy holds glob patterns, matched against unique identifiers, of extensions to allow
+// and deny. If there are allow patterns an extension must match at least one of them. Deny
+// patterns always win over allow patterns.
+type servePolicy struct {
+	allow []string
+	deny  []string
+}
+
+// loadServePolicy reads a policy file from path, see parseServePolicy.
+func loadServePolicy(path string) (servePolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return servePolicy{}, err
+	}
+	defer f.Close()
+	return parseServePolicy(f)
+}
+
+// parseServePolicy reads a policy with one rule per line. A rule is allow or deny followed by a
+// glob pattern, for example allow golang.* or deny ms-python.debugpy. Patterns are matched case
+// insensitive. Empty lines and lines starting with # are ignored.
+func parseServePolicy(r io.Reader) (servePolicy, error) {
+	p := servePolicy{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return servePolicy{}, fmt.Errorf("line %v: expected a rule like allow <pattern> or deny <pattern>, got %s", n, line)
+		}
+		pattern := strings.ToLower(fields[1])
+		if _, err := path.Match(pattern, ""); err != nil {
+			return servePolicy{}, fmt.Errorf("line %v: invalid pattern %s: %w", n, fields[1], err)
+		}
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			p.allow = append(p.allow, pattern)
+		case "deny":
+			p.deny = append(p.deny, pattern)
+		default:
+			return servePolicy{}, fmt.Errorf("line %v: unknown rule %s, expected allow or deny", n, fields[0])
+		}
+	}
+	return p, scanner.Err()
+}
+
+// allowed returns true if the extension with the unique identifier is exposed by the policy.
+func (p servePolicy) allowed(uniqueID string) bool {
+	uniqueID = strings.ToLower(uniqueID)
+	for _, pattern := range p.deny {
+		if matched, _ := path.Match(pattern, uniqueID); matched {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, pattern := range p.allow {
+		if matched, _ := path.Match(pattern, uniqueID); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedExtension is allowed for use as filter when querying the database.
+func (p servePolicy) allowedExtension(e vscode.Extension) bool {
+	return p.allowed(e.UniqueID())
+}
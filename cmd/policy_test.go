@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestParseServePolicy(t *testing.T) {
+	policy := `
+# comments and empty lines are ignored
+allow golang.*
+allow Redhat.*
+
+deny redhat.java
+`
+	p, err := parseServePolicy(strings.NewReader(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"golang.Go":         true,
+		"redhat.vscode-xml": true,
+		"RedHat.Java":       false,
+		"ms-python.python":  false,
+	}
+	for uniqueID, expected := range tests {
+		if actual := p.allowed(uniqueID); actual != expected {
+			t.Errorf("%s: expected %v but got %v", uniqueID, expected, actual)
+		}
+	}
+
+	p, err = parseServePolicy(strings.NewReader("deny ms-python.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.allowed("golang.Go") || p.allowed("ms-python.python") {
+		t.Error("expected only denied extensions to be hidden when there are no allow rules")
+	}
+	if !(servePolicy{}).allowed("golang.Go") {
+		t.Error("expected empty policy to allow all extensions")
+	}
+
+	invalid := []string{
+		"allow",
+		"permit golang.*",
+		"allow golang.[",
+		"allow golang.go extra",
+	}
+	for _, policy := range invalid {
+		if _, err := parseServePolicy(strings.NewReader(policy)); err == nil {
+			t.Errorf("%s: expected error", policy)
+		}
+	}
+}
+
+func TestServePolicyAsset(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"golang/go/1.0.0/1234/" + string(vscode.VSIXPackage):   "content",
+		"redhat/java/1.0.0/5678/" + string(vscode.VSIXPackage): "content",
+	})
+	db, err := database.OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultPolicy := servedExtensions
+	servedExtensions, err = parseServePolicy(strings.NewReader("deny redhat.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { servedExtensions = defaultPolicy }()
+
+	handler := assetHandler(db, "/assets/")
+	tests := map[string]int{
+		"/assets/golang/go/1.0.0/1234/" + string(vscode.VSIXPackage):   http.StatusOK,
+		"/assets/redhat/java/1.0.0/5678/" + string(vscode.VSIXPackage): http.StatusNotFound,
+	}
+	for url, expected := range tests {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Errorf("%s: expected status %v but got %v", url, expected, rec.Code)
+		}
+	}
+}
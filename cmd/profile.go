@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/rs/zerolog/log"
+)
+
+// profileHandler returns a handler serving pprof profiling data at /debug/pprof/.
+func profileHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// startProfiling serves pprof profiling data on addr in the background. Errors listening on
+// addr are returned, errors while serving are logged.
+func startProfiling(addr string) error {
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := http.Serve(ln, profileHandler()); err != nil {
+			log.Err(err).Str("addr", addr).Msg("profiling server stopped")
+		}
+	}()
+	return nil
+}
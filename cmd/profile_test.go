@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProfileHandler(t *testing.T) {
+	handler := profileHandler()
+	tests := map[string]int{
+		"/debug/pprof/":             http.StatusOK,
+		"/debug/pprof/heap?debug=1": http.StatusOK,
+		"/debug/pprof/cmdline":      http.StatusOK,
+	}
+	for url, expected := range tests {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Errorf("%s: expected status %v but got %v", url, expected, rec.Code)
+		}
+	}
+}
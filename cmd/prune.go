@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,11 +17,13 @@ import (
 
 var dry bool // execute in dry run mode
 var rmEmptyExt bool
+var unusedFor string
 
 func init() {
 	pruneCmd.Flags().StringVarP(&dbPath, "data", "d", ".", "path where downloaded extensions are stored [VSIX_DB_PATH]")
 	pruneCmd.Flags().BoolVar(&rmEmptyExt, "rm-empty-ext", false, "remove extensions without any versions")
 	pruneCmd.Flags().IntVar(&keep, "keep-versions", 0, "number of versions to keep, 0 keeps all (default 0)")
+	pruneCmd.Flags().StringVar(&unusedFor, "unused-for", "", "remove extensions not served for the given duration, for example 90d or 48h")
 	pruneCmd.Flags().BoolVar(&dry, "dry", false, "execute command without actually removing anything")
 	rootCmd.AddCommand(pruneCmd)
 }
@@ -43,13 +46,28 @@ Pruning versions
 ----------------
 Adding the --keep-versions X flag will keep the X latest versions and remove the rest.
 For example: --keep-versions 2, will remove all versions except the latest two.
+
+Pruning unused extensions
+-------------------------
+The serve-command records when an extension was last requested. Adding the
+--unused-for X flag will remove extensions that have not been requested within
+the given duration. The duration is given in days, for example 90d, or as a Go
+duration, for example 48h. Extensions that have never been requested are removed
+when they were added longer ago than the given duration.
 `,
 	Example:               "  $ vsix prune --data extensions --keep-versions 2",
 	DisableFlagsInUseLine: true,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		p, err := filepath.Abs(dbPath)
 		if err != nil {
-			log.Fatal().Str("command", "prune").Err(err).Send()
+			return err
+		}
+		var unusedDuration time.Duration
+		if unusedFor != "" {
+			unusedDuration, err = parseAge(unusedFor)
+			if err != nil {
+				return err
+			}
 		}
 
 		logger := log.With().Str("path", p).Str("command", "prune").Logger()
@@ -58,7 +76,7 @@ For example: --keep-versions 2, will remove all versions except the latest two.
 		// begin by cleaning local storage
 		cleanResult, err := database.CleanDBFiles(p)
 		if err != nil {
-			logger.Fatal().Err(err).Send()
+			return err
 		}
 		if len(cleanResult.Removed) == 0 && len(cleanResult.Optional) == 0 {
 			logger.Info().Msg("local storage did not need any cleanup")
@@ -90,7 +108,7 @@ For example: --keep-versions 2, will remove all versions except the latest two.
 		if keep > 0 {
 			db, err := database.OpenFs(p, false)
 			if err != nil {
-				log.Fatal().Err(err).Str("data_root", p).Msg("could not open folder")
+				return fmt.Errorf("could not open folder %s: %w", p, err)
 			}
 			exts := db.List(false)
 			for _, ext := range exts {
@@ -135,6 +153,48 @@ For example: --keep-versions 2, will remove all versions except the latest two.
 		} else {
 			logger.Info().Msg("versions will not be pruned")
 		}
+		if unusedDuration > 0 {
+			db, err := database.OpenFs(p, false)
+			if err != nil {
+				return fmt.Errorf("could not open folder %s: %w", p, err)
+			}
+			for _, ext := range db.List(false) {
+				lastAccessed, err := db.LastAccessed(ext)
+				if err != nil {
+					logger.Err(err).Str("extension", ext.UniqueID()).Msg("could not determine when extension was last accessed, skipping")
+					continue
+				}
+				if time.Since(lastAccessed) < unusedDuration {
+					logger.Debug().Str("extension", ext.UniqueID()).Time("last_accessed", lastAccessed).Msg("keeping extension, recently accessed")
+					continue
+				}
+				if dry {
+					logger.Info().Str("extension", ext.UniqueID()).Time("last_accessed", lastAccessed).Msg("would be removed without dry run")
+				} else {
+					if err := db.DeleteExtension(ext); err != nil {
+						logger.Err(err).Send()
+					}
+				}
+			}
+		}
 		logger.Info().Msgf("total time for prune %.3fs", time.Since(start).Seconds())
+		return nil
 	},
 }
+
+// parseAge parses a duration where, in addition to the units supported by
+// time.ParseDuration, the unit d for days is supported. For example 90d.
+func parseAge(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %s", s)
+	}
+	return d, nil
+}
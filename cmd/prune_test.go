@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		invalid  bool
+	}{
+		{"90d", 90 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"48h", 48 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"-1d", 0, true},
+		{"xd", 0, true},
+		{"90", 0, true},
+	}
+	for _, test := range tests {
+		d, err := parseAge(test.input)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.input, err)
+			continue
+		}
+		if d != test.expected {
+			t.Errorf("%s: expected %v but got %v", test.input, test.expected, d)
+		}
+	}
+}
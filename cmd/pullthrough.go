@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/marketplace"
+)
+
+var (
+	// pullThroughEnabled fetches extensions missing in the local storage from Marketplace when requested
+	pullThroughEnabled = false
+	// pullMissTTL is how long an extension not found at Marketplace is remembered as missing
+	pullMissTTL = 5 * time.Minute
+	// pullMisses holds when extensions were not found at Marketplace, guarded by pullMux
+	pullMisses = map[string]time.Time{}
+	// pullMux makes sure only one request at a time fetches missing extensions
+	pullMux sync.Mutex
+	// pullExtension fetches and saves an extension, replaced in tests
+	pullExtension = func(req marketplace.ExtensionRequest, db *database.DB) FetchResult {
+		return fetchExtension(req, db, []string{req.UniqueID}, "pull_through")
+	}
+)
+
+// pullThrough fetches the extensions among uniqueIDs that are not in the local storage
+// from Marketplace and reloads the database. It returns true if any extension was added.
+// Extensions not found at Marketplace are not looked up again until pullMissTTL has passed.
+func pullThrough(r *http.Request, db *database.DB, uniqueIDs []string) bool {
+	pullMux.Lock()
+	defer pullMux.Unlock()
+
+	added := false
+	for _, uniqueID := range uniqueIDs {
+		// checked after the lock is acquired since another request might have fetched it
+		if _, found := db.GetByUniqueID(false, uniqueID); found {
+			continue
+		}
+		lg := hlog.FromRequest(r).With().Str("unique_id", uniqueID).Logger()
+		key := strings.ToLower(uniqueID)
+		if missed, found := pullMisses[key]; found {
+			if time.Since(missed) < pullMissTTL {
+				lg.Debug().Msg("extension was recently not found at Marketplace, skipping")
+				continue
+			}
+			delete(pullMisses, key)
+		}
+		lg.Info().Msg("extension not found in local storage, fetching from Marketplace")
+		result := pullExtension(marketplace.ExtensionRequest{UniqueID: uniqueID}, db)
+		if errors.Is(result.Err, marketplace.ErrExtensionNotFound) || errors.Is(result.Err, marketplace.ErrExtensionUnpublished) {
+			pullMisses[key] = time.Now()
+		}
+		if result.Err != nil {
+			lg.Err(result.Err).Msg("could not fetch extension from Marketplace")
+		}
+		if result.Downloads > 0 {
+			added = true
+		}
+	}
+	if added {
+		if err := db.Reload(); err != nil {
+			hlog.FromRequest(r).Err(err).Msg("could not reload database after fetching extensions")
+			return false
+		}
+	}
+	return added
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/cobra"
+)
+
+var (
+	byExtensionID bool
+	confirmEach   bool
+)
+
+func init() {
+	dbRemoveCmd.Flags().BoolVar(&byExtensionID, "by-id", false, "identifiers are Marketplace extension IDs (GUIDs) instead of unique identifiers")
+	dbRemoveCmd.Flags().BoolVar(&confirmEach, "confirm-each", false, "ask for confirmation before removing each extension")
+	dbRemoveCmd.Flags().BoolVar(&dry, "dry", false, "execute command without actually removing anything")
+	dbCmd.AddCommand(dbRemoveCmd)
+}
+
+var dbRemoveCmd = &cobra.Command{
+	Use:     "remove <identifier...>",
+	Aliases: []string{"rm"},
+	Short:   "Remove extension(s) from the local storage",
+	Long: `Remove extension(s) from the local storage.
+
+Removes the given extensions, with all their versions, from the local storage. Extensions
+are given by their unique identifier, for example golang.Go. Use the by-id flag to give
+the Marketplace extension ID instead, for example 2b6ab3f4-1d29-4a4a-9b4b-4a4f9c4e1a1b.
+Identifiers not found in the local storage are reported and the command exits with exit
+code 3 once the remaining extensions have been removed. If an extension could not be
+removed the command exits with exit code 2.
+
+Give - as the only identifier to read identifiers from standard input instead, one per
+line. Use this when removing more extensions than fit on the command line, for example
+by piping the output of the list-command.
+
+Use confirm-each to be asked before each extension is removed. Answer y to remove the
+extension, n to keep it or q to keep it and all remaining extensions. Confirmation
+answers are read from standard input and can therefore not be combined with -.`,
+	Example: `  $ vsix db remove --data extensions golang.Go
+
+  $ vsix db remove --data extensions --by-id 2b6ab3f4-1d29-4a4a-9b4b-4a4f9c4e1a1b
+
+  $ vsix list --data extensions --tag keybindings | vsix db remove --data extensions -`,
+	Args:                  cobra.MinimumNArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.With().Str("path", dbPath).Str("command", "remove").Logger()
+		start := time.Now()
+		if len(args) == 1 && args[0] == "-" {
+			if confirmEach {
+				return errors.New("confirm-each can not be used when reading identifiers from stdin")
+			}
+			var err error
+			if args, err = readIdentifiers(cmd.InOrStdin()); err != nil {
+				return fmt.Errorf("could not read identifiers from stdin: %w", err)
+			}
+		}
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+
+		exts, err := findExtensions(db, args, byExtensionID)
+		removed, failed := 0, false
+		answers := bufio.NewReader(cmd.InOrStdin())
+		for _, ext := range exts {
+			if confirmEach {
+				answer, confirmErr := confirm(answers, cmd.ErrOrStderr(), fmt.Sprintf("remove %s?", ext.UniqueID()))
+				if confirmErr != nil {
+					// extensions already removed must still be announced to a running server
+					err = errors.Join(err, confirmErr)
+					break
+				}
+				if answer == 'q' {
+					break
+				}
+				if answer == 'n' {
+					continue
+				}
+			}
+			if dry {
+				logger.Info().Str("extension", ext.UniqueID()).Msg("would be removed without dry run")
+				continue
+			}
+			if rmErr := db.DeleteExtension(ext); rmErr != nil {
+				err = errors.Join(err, fmt.Errorf("could not remove %s, run the command again to finish removing it: %w", ext.UniqueID(), rmErr))
+				failed = true
+				continue
+			}
+			removed++
+		}
+		if removed > 0 {
+			if err := db.Modified(); err != nil {
+				logger.Err(err).Msg("could not notify server of removed extensions")
+			}
+		}
+		logger.Info().Msgf("removed %v extensions, command took %.3fs", removed, time.Since(start).Seconds())
+		if failed {
+			return withExitCode(exitPartial, err)
+		}
+		return err
+	},
+}
+
+// confirm writes prompt to w and reads the answer from r until a valid answer is given. It
+// returns y, n or q for yes, no and quit.
+func confirm(r *bufio.Reader, w io.Writer, prompt string) (rune, error) {
+	for {
+		fmt.Fprintf(w, "%s [y/n/q] ", prompt)
+		line, err := r.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return 'y', nil
+		case "n", "no":
+			return 'n', nil
+		case "q", "quit":
+			return 'q', nil
+		}
+		if err != nil {
+			return 'q', err
+		}
+	}
+}
+
+// readIdentifiers reads identifiers from r, one per line. Surrounding white space and empty
+// lines are ignored.
+func readIdentifiers(r io.Reader) ([]string, error) {
+	ids := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, scanner.Err()
+}
+
+// findExtensions looks up the extensions with the given identifiers in the database. Identifiers are
+// unique identifiers or, if byID is true, Marketplace extension IDs. Extensions that were found are
+// returned together with an error listing the identifiers that were not found.
+func findExtensions(db *database.DB, identifiers []string, byID bool) ([]vscode.Extension, error) {
+	exts := []vscode.Extension{}
+	var err error
+	for _, id := range identifiers {
+		if byID {
+			found := db.FindByExtensionID(false, id)
+			if len(found) == 0 {
+				err = errors.Join(err, fmt.Errorf("extension with ID %s was not found", id))
+				continue
+			}
+			exts = append(exts, found...)
+			continue
+		}
+		ext, found := db.GetByUniqueID(false, id)
+		if !found {
+			err = errors.Join(err, fmt.Errorf("extension %s was not found", id))
+			continue
+		}
+		exts = append(exts, ext)
+	}
+	return exts, withExitCode(exitNotFound, err)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spagettikod/vsix/database"
+)
+
+// removeTestRoot creates a local storage with the extensions golang.go and ms-python.python.
+func removeTestRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"golang/go/_vsix_db_extension_metadata.json":        `{"extensionId":"d6f6cfea-4b6f-41f4-b571-6ad2ab7918da","extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"ms-python/python/_vsix_db_extension_metadata.json": `{"extensionId":"f1f59ae4-9318-4f3c-a9b5-81b2eaa5f8a5","extensionName":"python","publisher":{"publisherName":"ms-python"}}`,
+	})
+	return root
+}
+
+// removeTestDB creates a database with the extensions golang.go and ms-python.python.
+func removeTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.OpenFs(removeTestRoot(t), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFindExtensions(t *testing.T) {
+	db := removeTestDB(t)
+
+	exts, err := findExtensions(db, []string{"golang.go", "foo.bar"}, false)
+	if err == nil {
+		t.Error("expected an error for the unknown extension foo.bar")
+	}
+	if len(exts) != 1 || exts[0].UniqueID() != "golang.go" {
+		t.Errorf("expected to find golang.go but got %v", exts)
+	}
+
+	exts, err = findExtensions(db, []string{"f1f59ae4-9318-4f3c-a9b5-81b2eaa5f8a5"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exts) != 1 || exts[0].UniqueID() != "ms-python.python" {
+		t.Errorf("expected to find ms-python.python by extension ID but got %v", exts)
+	}
+}
+
+func TestReadIdentifiers(t *testing.T) {
+	ids, err := readIdentifiers(strings.NewReader("golang.go\n\n  ms-python.python \r\nredhat.java"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"golang.go", "ms-python.python", "redhat.java"}
+	if !slices.Equal(ids, expected) {
+		t.Errorf("expected %v but got %v", expected, ids)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("maybe\nY\nno\nq\n"))
+	w := &strings.Builder{}
+	for _, expected := range []rune{'y', 'n', 'q'} {
+		answer, err := confirm(r, w, "remove golang.go?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if answer != expected {
+			t.Errorf("expected %c but got %c", expected, answer)
+		}
+	}
+	if _, err := confirm(r, w, "remove golang.go?"); err == nil {
+		t.Error("expected an error when there are no more answers")
+	}
+	if strings.Count(w.String(), "[y/n/q]") != 5 {
+		t.Errorf("expected the prompt to be repeated for the invalid answer, got %q", w.String())
+	}
+}
+
+func TestConfirmEachEndOfInput(t *testing.T) {
+	root := removeTestRoot(t)
+	defer func() { confirmEach = false }()
+	if err := executeCommand(t, strings.NewReader("y\n"), "db", "remove", "--data", root, "--confirm-each", "golang.go", "ms-python.python"); err == nil {
+		t.Error("expected an error when input ends before all extensions are confirmed")
+	}
+	if _, err := os.Stat(filepath.Join(root, "golang", "go")); !os.IsNotExist(err) {
+		t.Errorf("expected the confirmed golang.go to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "ms-python", "python")); err != nil {
+		t.Errorf("expected the unconfirmed ms-python.python to be kept, got %v", err)
+	}
+	// the removal is announced to a running server
+	if _, err := os.Stat(filepath.Join(root, ".modfile")); err != nil {
+		t.Errorf("expected the .modfile to be created, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spf13/cobra"
+)
+
+var repairAgainst string
+
+func init() {
+	dbRepairCmd.Flags().StringVar(&repairAgainst, "against", "", "also repair asset files that do not match this checksum manifest")
+	dbRepairCmd.Flags().BoolVar(&dry, "dry", false, "execute command without actually downloading anything")
+	dbCmd.AddCommand(dbRepairCmd)
+}
+
+var dbRepairCmd = &cobra.Command{
+	Use:     "repair [identifier...]",
+	Aliases: []string{"fetch-assets"},
+	Short:   "Download missing or corrupt asset files again",
+	Long: `Download missing or corrupt asset files again.
+
+Looks for asset files that are listed in the metadata of a version but are missing from
+the local storage and downloads them again from Marketplace. Only the damaged assets are
+downloaded, intact assets are left as they are. All extensions are checked unless
+extensions are given by their unique identifier.
+
+The command also fills in a local storage where only the metadata has been copied, for
+example from a metadata-only export, by downloading all assets listed in the metadata.
+For this use the command is also available as db fetch-assets.
+
+Use the against-flag to also repair asset files where the size or checksum differs from
+a checksum manifest created by the db checksums-command, see the verify-command.
+
+The command exits with exit code 2 if any asset could not be repaired and exit code
+3 if a given extension was not found.`,
+	Example: `  $ vsix db repair --data extensions
+
+  $ vsix db repair --data extensions --against checksums.json golang.Go
+
+  $ vsix db fetch-assets --data extensions`,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.With().Str("path", dbPath).Str("command", "repair").Logger()
+		start := time.Now()
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		var manifest map[string]database.Checksum
+		if repairAgainst != "" {
+			sums, err := database.ReadChecksumsFile(repairAgainst)
+			if err != nil {
+				return fmt.Errorf("could not read checksum manifest: %w", err)
+			}
+			manifest = map[string]database.Checksum{}
+			for _, sum := range sums {
+				manifest[sum.Path] = sum
+			}
+		}
+		exts := db.List(false)
+		if len(args) > 0 {
+			if exts, err = findExtensions(db, args, false); err != nil {
+				return err
+			}
+		}
+
+		repaired := 0
+		var errs error
+		for _, ext := range exts {
+			for _, v := range ext.Versions {
+				vlog := logger.With().Str("unique_id", ext.UniqueID()).Str("version", v.Version).Str("target_platform", v.TargetPlatform()).Logger()
+				damaged, err := db.DamagedAssets(ext, v, manifest)
+				if err != nil {
+					vlog.Err(err).Msg("could not check assets")
+					errs = errors.Join(errs, fmt.Errorf("%s %s: %w", ext.UniqueID(), v.Version, err))
+					continue
+				}
+				for _, a := range damaged {
+					alog := vlog.With().Str("asset_type", string(a.Type)).Str("source", a.Source).Logger()
+					if dry {
+						alog.Info().Msg("would be repaired without dry run")
+						continue
+					}
+					if a.Source == "" {
+						alog.Error().Msg("could not repair, metadata has no source for asset")
+						errs = errors.Join(errs, fmt.Errorf("%s: no source to download from", a.Path))
+						continue
+					}
+					content, err := marketplace.OpenAsset(a)
+					if err == nil {
+						err = db.RepairAssetFile(a, content)
+						content.Close()
+					}
+					if err != nil {
+						alog.Err(err).Msg("could not repair asset")
+						errs = errors.Join(errs, fmt.Errorf("%s: %w", a.Path, err))
+						continue
+					}
+					alog.Info().Msg("asset repaired")
+					repaired++
+				}
+			}
+		}
+		if repaired > 0 {
+			if err := db.Modified(); err != nil {
+				logger.Err(err).Msg("could not notify server of repaired extensions")
+			}
+		}
+		logger.Info().Msgf("repaired %v assets, command took %.3fs", repaired, time.Since(start).Seconds())
+		return withExitCode(exitPartial, errs)
+	},
+}
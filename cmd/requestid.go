@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// requestIDHeader is the header used to pass request IDs between proxies and serve
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength is the longest request ID accepted from a client
+	maxRequestIDLength = 128
+)
+
+// requestIDHandler adds a request ID to the logger of each request and returns it in the
+// X-Request-ID response header. The ID is taken from the X-Request-ID request header, as set
+// by a proxy, so logs can be correlated. A new ID is generated if the header is missing or not
+// a valid request ID.
+func requestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = xid.New().String()
+		}
+		w.Header().Set(requestIDHeader, id)
+		zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("request_id", id)
+		})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID returns true if id is a non-empty request ID of printable ASCII characters,
+// at most maxRequestIDLength long. This keeps clients from writing arbitrary data to the log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
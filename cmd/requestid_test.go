@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/justinas/alice"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := alice.New(hlog.NewHandler(zerolog.New(buf)), requestIDHandler).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		hlog.FromRequest(r).Info().Msg("handling request")
+	})
+
+	tests := []struct {
+		incoming  string
+		generated bool
+	}{
+		{"abc-123", false},
+		{"", true},
+		{"has spaces", true},
+		{strings.Repeat("a", maxRequestIDLength+1), true},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.incoming != "" {
+			req.Header.Set(requestIDHeader, test.incoming)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(requestIDHeader)
+		if id == "" {
+			t.Fatalf("%q: expected request ID in response header", test.incoming)
+		}
+		if !test.generated && id != test.incoming {
+			t.Errorf("%q: expected incoming request ID to be echoed, got %s", test.incoming, id)
+		}
+		if test.generated && id == test.incoming {
+			t.Errorf("%q: expected a new request ID to be generated", test.incoming)
+		}
+		entry := map[string]any{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["request_id"] != id {
+			t.Errorf("%q: expected log entry to have request ID %s, got %v", test.incoming, id, entry["request_id"])
+		}
+	}
+}
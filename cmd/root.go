@@ -1,13 +1,19 @@
 package cmd
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/marketplace"
 	"github.com/spf13/cobra"
 )
 
@@ -15,37 +21,147 @@ var (
 	rootCmd = &cobra.Command{
 		Use:   "vsix",
 		Short: "Visual Studio Code Extension Marketplace command line interface tool.",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		Long: `Visual Studio Code Extension Marketplace command line interface tool.
+
+Logging
+-------
+Log output is written to stderr, use the log-file flag to also write it to a file.
+The log level can be set per component with the environment variable
+VSIX_LOG_LEVELS, for example VSIX_LOG_LEVELS="database=debug,marketplace=info".
+Components without a level use the level set by the verbose or debug flags.
+
+Private galleries
+-----------------
+Set the environment variable VSIX_GALLERY_URL to the service URL of a private gallery,
+for example https://gallery.example.com/_apis/public/gallery, to query it instead of the
+public Marketplace. Queries are sent to <gallery URL>/extensionquery and the latest
+version of an extension is looked up at <gallery URL>/<publisher>/<name>/latest.
+
+Set the environment variable VSIX_MARKETPLACE_TOKEN to send a token in the
+Authorization header of gallery requests, for galleries requiring authentication. The
+token is sent with queries, to marketplace.visualstudio.com or VSIX_GALLERY_URL, and
+with latest version lookups when VSIX_GALLERY_URL is set. It is never sent to
+www.vscode-unpkg.net, where the latest version is looked up at the public Marketplace,
+or when downloading assets, which can be served from other hosts.
+
+Language
+--------
+Set the environment variable VSIX_LOCALE to a language tag, for example sv-SE, to get
+display names and descriptions from Marketplace in that language, where the extension
+has been translated. The locale is sent in the Accept-Language header of gallery
+queries and applies to search results as well as metadata stored by add and update.
+
+Certificates
+------------
+Set the environment variable VSIX_CA_CERT to a file with PEM encoded CA certificates
+to trust, in addition to the system certificates, when connecting to Marketplace. For
+example when connecting through a TLS-intercepting proxy or to a private gallery using
+certificates issued by an internal CA.
+
+Set VSIX_INSECURE_SKIP_VERIFY to true to not verify server certificates at all. This
+makes all connections to Marketplace insecure and should only be used for testing,
+for example against a mirror with a self-signed certificate.
+
+Exit codes
+----------
+0  the command succeeded
+1  invalid usage or the command failed
+2  the command completed but some extensions, versions or assets failed
+3  extensions given to the command were not found
+
+Temporary files
+---------------
+Assets are downloaded to a temporary file that is moved into the local storage once
+completely downloaded. By default the temporary file is created next to the asset in
+the local storage. Set the environment variable VSIX_TMPDIR to a directory to create
+temporary files there instead.`,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// flags and arguments are validated at this point, errors returned
+			// by the command itself should not print the usage
+			cmd.SilenceUsage = true
 			dbPath = EnvOrFlag("VSIX_DB_PATH", dbPath)
-			if !EnvOrFlagBool("VSIX_LOG_JSON", jsonLog) {
-				log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+			marketplace.UserAgent = EnvOrFlag("VSIX_USER_AGENT", userAgent)
+			if marketplace.UserAgent == "" {
+				marketplace.UserAgent = "vsix/" + cmd.Root().Version
 			}
-			zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+			marketplace.Token = os.Getenv("VSIX_MARKETPLACE_TOKEN")
+			if galleryURL, found := os.LookupEnv("VSIX_GALLERY_URL"); found {
+				if err := marketplace.SetGalleryURL(galleryURL); err != nil {
+					return fmt.Errorf("invalid VSIX_GALLERY_URL: %w", err)
+				}
+			}
+			marketplace.Locale = os.Getenv("VSIX_LOCALE")
+			if database.TempDir = os.Getenv("VSIX_TMPDIR"); database.TempDir != "" {
+				if fi, err := os.Stat(database.TempDir); err != nil || !fi.IsDir() {
+					return fmt.Errorf("VSIX_TMPDIR %s is not a directory", database.TempDir)
+				}
+			}
+			if caCert, found := os.LookupEnv("VSIX_CA_CERT"); found {
+				if err := marketplace.AddCACertFile(caCert); err != nil {
+					return fmt.Errorf("could not load CA certificate from VSIX_CA_CERT: %w", err)
+				}
+			}
+			if val, found := os.LookupEnv("VSIX_INSECURE_SKIP_VERIFY"); found {
+				skip, err := strconv.ParseBool(val)
+				if err != nil {
+					return fmt.Errorf("invalid value %s for VSIX_INSECURE_SKIP_VERIFY, expected true or false", val)
+				}
+				marketplace.SkipVerify(skip)
+				if skip {
+					// printed regardless of log level, this should never go unnoticed
+					fmt.Fprintln(cmd.ErrOrStderr(), "WARNING: VSIX_INSECURE_SKIP_VERIFY is set, server certificates are not verified and connections are insecure")
+				}
+			}
+			w, err := logWriter(EnvOrFlagBool("VSIX_LOG_JSON", jsonLog), EnvOrFlag("VSIX_LOG_FILE", logFile))
+			if err != nil {
+				return err
+			}
+			level := zerolog.ErrorLevel
 			if EnvOrFlagBool("VSIX_LOG_VERBOSE", verbose) {
-				zerolog.SetGlobalLevel(zerolog.InfoLevel)
+				level = zerolog.InfoLevel
 			}
 			if EnvOrFlagBool("VSIX_LOG_DEBUG", debug) {
-				zerolog.SetGlobalLevel(zerolog.DebugLevel)
+				level = zerolog.DebugLevel
+			}
+			componentLevels, err := parseLogLevels(os.Getenv("VSIX_LOG_LEVELS"))
+			if err != nil {
+				return err
 			}
+			log.Logger = log.Output(componentLevelWriter{w: zerolog.MultiLevelWriter(w), level: level, components: componentLevels})
+			// the global level must allow the most verbose component level, events are
+			// then filtered per component by componentLevelWriter
+			for _, l := range componentLevels {
+				level = min(level, l)
+			}
+			zerolog.SetGlobalLevel(level)
+			return nil
 		},
 	}
-	verbose bool
-	debug   bool
-	jsonLog bool
+	verbose   bool
+	debug     bool
+	jsonLog   bool
+	userAgent string
+	logFile   string
 	// out                          string   // used by sub-commands
 	limit                        int      // used by sub-commands
 	sortByFlag                   string   // used by sub-commands
+	sortOrderFlag                string   // used by sub-commands
 	dbPath                       string   // used by sub-commands
 	serveAddr                    string   // used by sub-commands
 	serveCert                    string   // used by sub-commands
+	serveReadOnly                bool     // used by sub-commands
 	serveKey                     string   // used by sub-commands
+	serveProfile                 string   // used by sub-commands
 	targetPlatforms              []string // used by sub-commands
+	assetTypes                   []string // used by sub-commands
 	preRelease                   bool     // used by sub-commands
 	force                        bool     // used by sub-commands
 	quiet                        bool     // used by sub-commands (search)
 	nolimit                      bool     // used by sub-commands (search)
 	keep                         int      // used by sub-commands
 	threads                      int      // used by sub-commands
+	runReport                    string   // used by sub-commands
 	ErrFileExists                error    = errors.New("extension has already been downloaded")
 	ErrVersionNotFound           error    = errors.New("could not find version at Marketplace")
 	ErrOutDirNotFound            error    = errors.New("output dir does not exist")
@@ -56,9 +172,85 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "turn on debug logging [VSIX_LOG_DEBUG]")
 	rootCmd.PersistentFlags().BoolVar(&jsonLog, "json", false, "log output as JSON [VSIX_LOG_JSON]")
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "turn on verbose logging [VSIX_LOG_VERBOSE]")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "also write log output to this file [VSIX_LOG_FILE]")
+	rootCmd.PersistentFlags().StringVar(&userAgent, "user-agent", "", "User-Agent sent in requests to Marketplace, defaults to vsix/<version> [VSIX_USER_AGENT]")
+}
+
+// logWriter returns the writer used for log output. Logs are written to stderr, as JSON or
+// in a human readable format. If logFile is set logs are also appended to the file, using
+// the same format but without colors.
+func logWriter(jsonFormat bool, logFile string) (io.Writer, error) {
+	newWriter := func(out io.Writer, noColor bool) io.Writer {
+		if jsonFormat {
+			return out
+		}
+		return zerolog.ConsoleWriter{Out: out, NoColor: noColor, TimeFormat: time.RFC3339}
+	}
+	if logFile == "" {
+		return newWriter(os.Stderr, false), nil
+	}
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open log file: %w", err)
+	}
+	return zerolog.MultiLevelWriter(newWriter(os.Stderr, false), newWriter(f, true)), nil
+}
+
+// componentLevelWriter filters log events by the level set for the component the event
+// belongs to. Events without a component, or from a component without a level, are
+// filtered using the default level.
+type componentLevelWriter struct {
+	w          zerolog.LevelWriter
+	level      zerolog.Level
+	components map[string]zerolog.Level
+}
+
+func (c componentLevelWriter) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+func (c componentLevelWriter) WriteLevel(l zerolog.Level, p []byte) (int, error) {
+	level := c.level
+	if len(c.components) > 0 {
+		event := struct {
+			Component string `json:"component"`
+		}{}
+		if err := json.Unmarshal(p, &event); err == nil {
+			if componentLevel, found := c.components[event.Component]; found {
+				level = componentLevel
+			}
+		}
+	}
+	if l < level {
+		return len(p), nil
+	}
+	return c.w.WriteLevel(l, p)
+}
+
+// parseLogLevels parses a comma separated list of component levels, for example
+// database=debug,marketplace=info.
+func parseLogLevels(s string) (map[string]zerolog.Level, error) {
+	levels := map[string]zerolog.Level{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		component, levelName, found := strings.Cut(item, "=")
+		if !found || component == "" {
+			return nil, fmt.Errorf("invalid component log level %s, expected component=level", item)
+		}
+		level, err := zerolog.ParseLevel(levelName)
+		if err != nil || levelName == "" {
+			return nil, fmt.Errorf("invalid log level %s for component %s", levelName, component)
+		}
+		levels[component] = level
+	}
+	return levels, nil
 }
 
-// Execute TODO
+// Execute runs the root command. Errors returned by sub-commands are printed to stderr
+// and the process exits with exit code 1, or the code given by an exitError.
 func Execute(version string) {
 	rootCmd.Version = version
 	rootCmd.SetVersionTemplate(`{{printf "%s" .Version}}
@@ -66,7 +258,7 @@ func Execute(version string) {
 	log.Logger = log.With().Str("vsix_version", rootCmd.Version).Logger()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
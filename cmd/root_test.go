@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// writeFixture writes files, mapping a path relative to root to its content, to the file
+// system. Folders are created as needed.
+func writeFixture(t testing.TB, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// executeCommand runs the command line args, without the program name, with stdin as standard
+// input. The logger set up by the root command is restored afterwards so other tests are not
+// affected by it.
+func executeCommand(t testing.TB, stdin io.Reader, args ...string) error {
+	t.Helper()
+	logger, level := log.Logger, zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = logger
+		zerolog.SetGlobalLevel(level)
+		rootCmd.SetArgs(nil)
+		rootCmd.SetIn(nil)
+	}()
+	rootCmd.SetArgs(args)
+	rootCmd.SetIn(stdin)
+	return rootCmd.Execute()
+}
+
+func TestLogWriterFile(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "vsix.log")
+	for _, json := range []bool{true, false} {
+		w, err := logWriter(json, logFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := zerolog.New(w)
+		logger.Error().Msg("written to file")
+	}
+	b, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := strings.Count(string(b), "written to file"); c != 2 {
+		t.Errorf("expected 2 log lines in file, got %v: %s", c, b)
+	}
+	if strings.Contains(string(b), "\x1b[") {
+		t.Errorf("expected log file without colors, got %q", b)
+	}
+}
+
+func TestLogWriterInvalidFile(t *testing.T) {
+	if _, err := logWriter(true, filepath.Join(t.TempDir(), "missing", "vsix.log")); err == nil {
+		t.Error("expected error when log file can not be created")
+	}
+}
+
+func TestParseLogLevels(t *testing.T) {
+	levels, err := parseLogLevels("database=debug, marketplace=info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels["database"] != zerolog.DebugLevel || levels["marketplace"] != zerolog.InfoLevel || len(levels) != 2 {
+		t.Errorf("unexpected levels %v", levels)
+	}
+	for _, s := range []string{"database", "database=", "=debug", "database=loud"} {
+		if _, err := parseLogLevels(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestComponentLevelWriter(t *testing.T) {
+	buf := &strings.Builder{}
+	w := componentLevelWriter{
+		w:          zerolog.MultiLevelWriter(buf),
+		level:      zerolog.ErrorLevel,
+		components: map[string]zerolog.Level{"database": zerolog.DebugLevel},
+	}
+	logger := zerolog.New(w).Level(zerolog.DebugLevel)
+	logger.Debug().Str("component", "database").Msg("database debug")
+	logger.Debug().Str("component", "update").Msg("update debug")
+	logger.Debug().Msg("no component debug")
+	logger.Error().Str("component", "update").Msg("update error")
+
+	out := buf.String()
+	for _, expected := range []string{"database debug", "update error"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in log output: %s", expected, out)
+		}
+	}
+	for _, unexpected := range []string{"update debug", "no component debug"} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("did not expect %q in log output: %s", unexpected, out)
+		}
+	}
+}
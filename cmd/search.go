@@ -3,19 +3,40 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/database"
 	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spagettikod/vsix/vscode"
 	"github.com/spf13/cobra"
 )
 
+var (
+	publishedAfter  string
+	publishedBefore string
+	searchSource    string
+	minRating       float32
+	offset          int
+	featured        bool
+)
+
 func init() {
 	searchCmd.Flags().IntVarP(&limit, "limit", "l", 20, "limit number of results")
 	searchCmd.Flags().StringVarP(&sortByFlag, "sort", "s", "install", "sort critera, valid values are: none, install, rating, date")
+	searchCmd.Flags().StringVar(&sortOrderFlag, "sort-order", "", "sort order, valid values are: asc, desc, default is descending")
 	searchCmd.Flags().BoolVar(&preRelease, "pre-release", false, "include pre-release versions")
+	searchCmd.Flags().IntVar(&offset, "offset", 0, "number of results to skip, use together with limit to page through results")
 	searchCmd.Flags().BoolVar(&nolimit, "nolimit", false, "disables the result limit, all matching results are shown")
+	searchCmd.Flags().StringVar(&publishedAfter, "published-after", "", "only show extensions published after the given date, for example 2023-01-01")
+	searchCmd.Flags().StringVar(&publishedBefore, "published-before", "", "only show extensions published before the given date, for example 2023-01-01")
+	searchCmd.Flags().Float32Var(&minRating, "min-rating", 0, "only show extensions with an average rating of at least the given value, for example 4.0")
+	searchCmd.Flags().BoolVar(&featured, "featured", false, "only show extensions featured at Marketplace")
+	searchCmd.Flags().StringVar(&searchSource, "source", "marketplace", "where to search, valid values are: marketplace, local")
+	searchCmd.Flags().StringVarP(&dbPath, "data", "d", ".", "path where downloaded extensions are stored, used with --source local [VSIX_DB_PATH]")
 	searchCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "only print unique identifier")
 	rootCmd.AddCommand(searchCmd)
 }
@@ -27,10 +48,51 @@ var searchCmd = &cobra.Command{
 
 Without any parameters the command lists extensions at Marketplace sorted by install count.
 By default it limits the result to 20 items. Sort order and limits can be controlled
-by flags.`,
-	Example:               "  $ vsix search docker",
+by flags. Results are shown in the order returned by Marketplace, with sort none
+this is the Marketplace default order. Pages are fetched one at a time so the same
+query gives the same order as long as Marketplace does not change.
+
+Results are sorted in descending order, most installs, highest rating or latest
+published first. Use --sort-order asc to reverse the order, for example to show the
+oldest extensions first.
+
+Use offset to skip the first results, for example --limit 20 --offset 20 shows
+results 21 to 40. Skipped results are still fetched, filters are applied before
+results are skipped.
+
+Use --featured to list the extensions featured at Marketplace. Combine with
+--sort none to show them in the order they are featured. Featured extensions can
+not be combined with a search query or with --source local.
+
+Use --source local to search the extensions in the local storage instead of
+Marketplace. Results are shown in the same format, local search only supports
+sorting by install count, rating and date.
+
+The badges column shows verified for extensions from verified publishers and
+preview for extensions marked as preview.
+
+Results can be limited to extensions published within a date range using the
+published-after and published-before flags. Dates are given as YYYY-MM-DD.
+Marketplace can not filter by date, matching extensions are filtered locally
+which means more pages might be fetched from Marketplace to reach the limit.
+
+Use min-rating to only show extensions with an average rating of at least the
+given value. Extensions without ratings are not shown when min-rating is used.
+Like the date filters the rating is filtered locally.
+
+A footer after the results shows how many extensions are shown out of the total
+number of extensions matching the query, as reported by Marketplace. The total does
+not take the date and rating filters into account. The footer is not shown with
+--quiet.
+
+With --quiet only unique identifiers are printed and statistics, like install count
+and rating, are not requested from Marketplace. This makes fetching large numbers
+of results faster. Statistics are still requested if min-rating is used.`,
+	Example: `  $ vsix search docker
+
+  $ vsix search --featured --sort none`,
 	DisableFlagsInUseLine: true,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		q := ""
 		if len(args) == 1 {
 			q = args[0]
@@ -38,22 +100,63 @@ by flags.`,
 		if nolimit {
 			limit = 0
 		}
-		log.Info().Str("query", q).Msg("looking up extension at Marketplace")
+		if offset < 0 {
+			return fmt.Errorf("offset can not be negative, got %v", offset)
+		}
+		fetchLimit := limit
+		if limit > 0 {
+			fetchLimit = limit + offset
+		}
+		if searchSource != "marketplace" && searchSource != "local" {
+			return fmt.Errorf("%s is not a valid source, valid values are: marketplace, local", searchSource)
+		}
+		log.Info().Str("query", q).Str("source", searchSource).Msg("looking up extensions")
 		sortCritera, err := parseSortCriteria(sortByFlag)
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return err
+		}
+		sortOrder, err := parseSortOrder(sortOrderFlag)
+		if err != nil {
+			return err
+		}
+
+		if featured && q != "" {
+			return fmt.Errorf("featured can not be combined with a search query")
+		}
+		if featured && searchSource == "local" {
+			return fmt.Errorf("featured is not available with --source local, the local storage does not know which extensions are featured")
 		}
 
 		query := marketplace.QueryNoCritera(sortCritera)
 		if q != "" {
 			query = marketplace.QueryLastestVersionByText(q, sortCritera)
 		}
+		if featured {
+			query = marketplace.QueryFeatured(sortCritera)
+		}
+		query.Filters[0].SortOrder = sortOrder
 
-		exts, err := query.RunAll(limit)
+		published, err := publishedFilter(publishedAfter, publishedBefore)
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return err
+		}
+		keep := allFilters(published, ratingFilter(minRating))
+		if !statisticsNeeded(quiet, minRating) {
+			// statistics are computed by Marketplace for every result, skip them when they are not shown
+			query.Flags &^= marketplace.FlagIncludeStatistics
+		}
+
+		var exts []vscode.Extension
+		var total int
+		var runErr error
+		if searchSource == "local" {
+			exts, total, runErr = runLocal(query, fetchLimit, keep)
+		} else {
+			exts, total, runErr = query.RunAllCounted(fetchLimit, keep)
+		}
+		exts = exts[min(offset, len(exts)):]
+		if runErr != nil && len(exts) == 0 {
+			return runErr
 		}
 
 		data := [][]string{}
@@ -70,6 +173,7 @@ by flags.`,
 				extData = append(extData, ext.DisplayName)
 			}
 			extData = append(extData, ext.Publisher.DisplayName)
+			extData = append(extData, badges(ext))
 			extData = append(extData, ext.LatestVersion(preRelease))
 			extData = append(extData, ext.LastUpdated.Format(time.RFC3339))
 			extData = append(extData, fmt.Sprint(ext.InstallCount()))
@@ -82,28 +186,98 @@ by flags.`,
 			data = append(data, extData)
 		}
 
-		if quiet {
-			os.Exit(0)
-		}
-
-		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"Unique ID", "Name", "Publisher", "Latest Version", "Last Updated", "Installs", "Rating"})
-		table.SetAutoWrapText(false)
-		table.SetAutoFormatHeaders(true)
-		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
-		table.SetAlignment(tablewriter.ALIGN_LEFT)
-		table.SetCenterSeparator("")
-		table.SetColumnSeparator("")
-		table.SetRowSeparator("")
-		table.SetHeaderLine(false)
-		table.SetBorder(false)
-		table.SetTablePadding("\t") // pad with tabs
-		table.SetNoWhiteSpace(true)
-		table.AppendBulk(data) // Add Bulk Data
-		table.Render()
+		if !quiet {
+			renderTable([]string{"Unique ID", "Name", "Publisher", "Badges", "Latest Version", "Last Updated", "Installs", "Rating"}, data)
+			fmt.Println(footer(len(exts), total))
+		}
+
+		// results fetched before an error occured are printed before returning the error
+		return runErr
 	},
 }
 
+// badges returns the Marketplace badges of the extension, like verified publisher, as a
+// comma separated list.
+func badges(ext vscode.Extension) string {
+	b := []string{}
+	if ext.Publisher.IsVerified() {
+		b = append(b, "verified")
+	}
+	if ext.IsPreview() {
+		b = append(b, "preview")
+	}
+	return strings.Join(b, ", ")
+}
+
+// statisticsNeeded returns true if extension statistics must be requested from Marketplace, they
+// are shown unless quiet is true and used when filtering by rating.
+func statisticsNeeded(quiet bool, minRating float32) bool {
+	return !quiet || minRating > 0
+}
+
+// runLocal runs the query against the local storage, page by page in the same way
+// Query.RunAllCounted runs it against Marketplace.
+func runLocal(query marketplace.Query, limit int, keep func(vscode.Extension) bool) ([]vscode.Extension, int, error) {
+	db, err := database.OpenFs(dbPath, false)
+	if err != nil {
+		return nil, -1, fmt.Errorf("could not open folder %s: %w", dbPath, err)
+	}
+	query.Filters[0].PageSize = marketplace.MaximumPageSize
+	exts := []vscode.Extension{}
+	total := -1
+	for page := 1; ; page++ {
+		query.Filters[0].PageNumber = page
+		res, err := db.Run(query)
+		if err != nil {
+			return exts, total, err
+		}
+		if count, found := vscode.TotalCount(res.Results[0].ResultMetadata); found && total == -1 {
+			total = count
+		}
+		pageExts := res.Results[0].Extensions
+		for _, ext := range pageExts {
+			if keep != nil && !keep(ext) {
+				continue
+			}
+			exts = append(exts, ext)
+			if limit > 0 && len(exts) >= limit {
+				return exts, total, nil
+			}
+		}
+		if len(pageExts) < marketplace.MaximumPageSize {
+			return exts, total, nil
+		}
+	}
+}
+
+// footer returns a summary line printed after a table of extensions, like Showing 20 of 4312
+// extensions. The total is left out if it is below zero.
+func footer(shown, total int) string {
+	if total < 0 {
+		return fmt.Sprintf("Showing %v extensions", shown)
+	}
+	return fmt.Sprintf("Showing %v of %v extensions", shown, total)
+}
+
+// renderTable prints data as a tab padded table, without borders, to stdout.
+func renderTable(header []string, data [][]string) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetTablePadding("\t") // pad with tabs
+	table.SetNoWhiteSpace(true)
+	table.AppendBulk(data) // Add Bulk Data
+	table.Render()
+}
+
 func parseSortCriteria(sortBy string) (marketplace.SortCriteria, error) {
 	switch sortBy {
 	case "install":
@@ -117,3 +291,72 @@ func parseSortCriteria(sortBy string) (marketplace.SortCriteria, error) {
 	}
 	return marketplace.ByNone, fmt.Errorf("%s is not a valid sort critera", sortBy)
 }
+
+func parseSortOrder(order string) (marketplace.SortOrder, error) {
+	switch order {
+	case "":
+		return marketplace.SortDefault, nil
+	case "asc":
+		return marketplace.SortAscending, nil
+	case "desc":
+		return marketplace.SortDescending, nil
+	}
+	return marketplace.SortDefault, fmt.Errorf("%s is not a valid sort order, valid values are: asc, desc", order)
+}
+
+// ratingFilter returns a filter keeping extensions with an average rating of at least atLeast.
+// Nil is returned if atLeast is zero or less.
+func ratingFilter(atLeast float32) func(vscode.Extension) bool {
+	if atLeast <= 0 {
+		return nil
+	}
+	return func(e vscode.Extension) bool {
+		return e.AverageRating() >= atLeast
+	}
+}
+
+// allFilters combines the filters into one, keeping extensions kept by all of them. Nil filters
+// are ignored and nil is returned if all filters are nil.
+func allFilters(filters ...func(vscode.Extension) bool) func(vscode.Extension) bool {
+	filters = slices.DeleteFunc(filters, func(f func(vscode.Extension) bool) bool { return f == nil })
+	if len(filters) == 0 {
+		return nil
+	}
+	return func(e vscode.Extension) bool {
+		for _, keep := range filters {
+			if !keep(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// publishedFilter returns a function keeping extensions published after and before the given
+// dates. A nil function is returned if neither date is given.
+func publishedFilter(after, before string) (func(vscode.Extension) bool, error) {
+	if after == "" && before == "" {
+		return nil, nil
+	}
+	afterDate, beforeDate := time.Time{}, time.Time{}
+	var err error
+	if after != "" {
+		if afterDate, err = time.Parse(time.DateOnly, after); err != nil {
+			return nil, fmt.Errorf("invalid date %s, expected format YYYY-MM-DD", after)
+		}
+	}
+	if before != "" {
+		if beforeDate, err = time.Parse(time.DateOnly, before); err != nil {
+			return nil, fmt.Errorf("invalid date %s, expected format YYYY-MM-DD", before)
+		}
+	}
+	return func(e vscode.Extension) bool {
+		if !afterDate.IsZero() && !e.PublishedDate.After(afterDate) {
+			return false
+		}
+		if !beforeDate.IsZero() && !e.PublishedDate.Before(beforeDate) {
+			return false
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestPublishedFilter(t *testing.T) {
+	if keep, err := publishedFilter("", ""); keep != nil || err != nil {
+		t.Errorf("expected no filter and no error, got %v", err)
+	}
+	if _, err := publishedFilter("2023-13-01", ""); err == nil {
+		t.Error("expected error for invalid date")
+	}
+
+	keep, err := publishedFilter("2023-01-01", "2024-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"2022-12-31": false,
+		"2023-06-01": true,
+		"2024-01-02": false,
+	}
+	for date, expected := range tests {
+		published, _ := time.Parse(time.DateOnly, date)
+		if keep(vscode.Extension{PublishedDate: published}) != expected {
+			t.Errorf("%s: expected %v", date, expected)
+		}
+	}
+}
+
+func TestRatingFilter(t *testing.T) {
+	if ratingFilter(0) != nil {
+		t.Error("expected no filter for min rating 0")
+	}
+	rated := func(avg float32) vscode.Extension {
+		return vscode.Extension{Statistics: []vscode.Statistic{{Name: "averagerating", Value: avg}, {Name: "ratingcount", Value: 10}}}
+	}
+	keep := allFilters(nil, ratingFilter(4.0))
+	tests := []struct {
+		ext      vscode.Extension
+		expected bool
+	}{
+		{rated(4.5), true},
+		{rated(4.0), true},
+		{rated(3.9), false},
+		{vscode.Extension{}, false},
+	}
+	for _, test := range tests {
+		if keep(test.ext) != test.expected {
+			t.Errorf("rating %v: expected %v", test.ext.AverageRating(), test.expected)
+		}
+	}
+	if allFilters(nil, nil) != nil {
+		t.Error("expected no filter when all filters are nil")
+	}
+}
+
+func TestFooter(t *testing.T) {
+	if actual := footer(20, 4312); actual != "Showing 20 of 4312 extensions" {
+		t.Errorf("unexpected footer %s", actual)
+	}
+	if actual := footer(3, -1); actual != "Showing 3 extensions" {
+		t.Errorf("unexpected footer without total %s", actual)
+	}
+}
+
+func TestStatisticsNeeded(t *testing.T) {
+	tests := []struct {
+		quiet     bool
+		minRating float32
+		expected  bool
+	}{
+		{false, 0, true},
+		{true, 0, false},
+		{true, 4, true},
+	}
+	for _, test := range tests {
+		if got := statisticsNeeded(test.quiet, test.minRating); got != test.expected {
+			t.Errorf("quiet %v, min rating %v: expected %v, got %v", test.quiet, test.minRating, test.expected, got)
+		}
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	tests := map[string]marketplace.SortOrder{
+		"":     marketplace.SortDefault,
+		"asc":  marketplace.SortAscending,
+		"desc": marketplace.SortDescending,
+	}
+	for flag, expected := range tests {
+		if order, err := parseSortOrder(flag); err != nil || order != expected {
+			t.Errorf("%q: expected %v, got %v: %v", flag, expected, order, err)
+		}
+	}
+	if _, err := parseSortOrder("up"); err == nil {
+		t.Error("expected error for invalid sort order")
+	}
+}
@@ -3,14 +3,20 @@ package cmd
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/justinas/alice"
@@ -27,11 +33,20 @@ const (
 	assetURLPath = "assets/"
 )
 
+var (
+	gzipEnabled = true
+	gzipLevel   = gzip.DefaultCompression
+	// compressedAssetTypes are asset types already compressed, these are never gzipped
+	compressedAssetTypes = []vscode.AssetTypeKey{vscode.VSIXPackage, vscode.IconsDefault, vscode.IconsSmall}
+)
+
 func init() {
 	serveCmd.Flags().StringVarP(&dbPath, "data", "d", ".", "path where downloaded extensions are stored [VSIX_DB_PATH]")
-	serveCmd.Flags().StringVar(&serveAddr, "addr", "0.0.0.0:8080", "address where the server listens for connections")
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "0.0.0.0:8080", "address where the server listens for connections [VSIX_SERVE_ADDR]")
 	serveCmd.Flags().StringVar(&serveCert, "cert", "", "certificate file if serving with TLS [VSIX_CERT_FILE]")
+	serveCmd.Flags().BoolVar(&serveReadOnly, "read-only", false, "never write to the local storage [VSIX_SERVE_READ_ONLY]")
 	serveCmd.Flags().StringVar(&serveKey, "key", "", "certificate key file if serving with TLS [VSIX_KEY_FILE]")
+	serveCmd.Flags().StringVar(&serveProfile, "profile", "", "enable pprof profiling on this separate address, for example localhost:6060 [VSIX_SERVE_PPROF]")
 	rootCmd.AddCommand(serveCmd)
 }
 
@@ -46,6 +61,65 @@ using the add command. If the update-command is run and new extensions are
 downloaded while the serve-command is running it will automatically update with
 the newly downloaded extensions. 
 
+Assets are served gzip compressed, except for already compressed assets like the
+VSIX package and icons. The compression level can be set with the environment
+variable VSIX_SERVE_GZIP_LEVEL to 0-9 or off to disable compression.
+
+Set the environment variable VSIX_SERVE_PULL_THROUGH to true to fetch extensions
+that are not in the local storage from Marketplace when they are requested by
+name, for example when installing an extension. Fetched extensions are saved in
+the local storage and served from there the next time. Extensions that can not
+be found at Marketplace are not looked up again for 5 minutes, this can be changed
+with VSIX_SERVE_PULL_THROUGH_MISS_TTL, for example 1h.
+
+The server answers gallery API version 3.x, the version used by Visual Studio Code.
+Queries asking for another version in the api-version parameter of the Accept
+header are rejected with HTTP 400.
+
+The server starts listening once the local storage has been loaded. Loading a large
+local storage takes a while, progress is printed to stderr regardless of log level.
+
+The server listens on the address given by --addr or VSIX_SERVE_ADDR, for example
+0.0.0.0:8080 or [::]:8080. The flag overrides the environment variable. Give a path prefixed with unix:, for example
+unix:/run/vsix.sock, to listen on a unix socket instead, for example when running
+behind a reverse proxy. The socket file is removed when the server is stopped.
+
+Set the environment variable VSIX_SERVE_POLICY to a policy file to limit which of the
+extensions in the local storage are served. Each line in the file is a rule, allow or
+deny, followed by a pattern matching unique identifiers, for example:
+
+  # only serve extensions from golang and redhat, except redhat.java
+  allow golang.*
+  allow redhat.*
+  deny redhat.java
+
+If the policy has allow rules only extensions matching one of them are served. Deny
+rules always win over allow rules. Extensions that are not served are left out of
+query results and their assets return HTTP 404, they are still kept in the local
+storage. Pull-through never fetches extensions that are not served.
+
+Each request is logged with a request ID, returned to the client in the X-Request-ID
+header. If the request already has an X-Request-ID header, for example set by a
+reverse proxy, that ID is used so log entries can be correlated with the proxy.
+
+Use --profile, or set VSIX_SERVE_PPROF, to an address, for example localhost:6060, to
+serve pprof profiling data on a separate listener at /debug/pprof/. Use it with go tool
+pprof to diagnose memory or CPU usage. Profiling data is never served on the address of
+the marketplace and the profiling address should not be exposed publicly.
+
+Set VSIX_SERVE_WARM to true to warm up the server when it starts. The query sent by
+Visual Studio Code when the extensions view is opened is run once and the icons,
+manifests and details of the latest versions are read from disk, to get them into
+the page cache of the operating system. Warming up runs in the background while the
+server starts listening.
+
+Use --read-only, or set VSIX_SERVE_READ_ONLY to true, to serve from a read-only file
+system. The flag overrides the environment variable.
+The server then never writes to the local storage: it does not record when
+extensions are served, for the unused-for flag of the prune-command, and does not
+create the .modfile. Changes to the local storage are only reloaded if the .modfile
+already exists. Pull-through can not be used in read-only mode.
+
 To enable Visual Studio Code integration you must change the tag serviceUrl in
 the file project.json in your Visual Studio Code installation. On MacOS, for
 example, the file is located at
@@ -53,15 +127,60 @@ example, the file is located at
 the URL to your server, for example https://vsix.example.com:8080, see examples
 below.
 `,
-	Example:               `  $ vsix serve --data extensions --cert myserver.crt --key myserver.key https://www.example.com/vsix`,
+	Example: `  $ vsix serve --data extensions --cert myserver.crt --key myserver.key https://www.example.com/vsix
+
+  $ vsix serve --data extensions --addr :9000 http://localhost:9000`,
 	DisableFlagsInUseLine: true,
-	Run: func(cmd *cobra.Command, args []string) {
-		externalURL := EnvOrArg("VSIX_EXTERNAL_URL", args, 0)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		externalURL, err := EnvOrArg("VSIX_EXTERNAL_URL", args, 0)
+		if err != nil {
+			return err
+		}
 		// setup URLs and server root
 		server, apiRoot, assetRoot, err := parseEndpoints(externalURL)
 		if err != nil {
-			fmt.Printf("given URL is not valid: %s\n", externalURL)
-			os.Exit(1)
+			return fmt.Errorf("given URL is not valid: %s", externalURL)
+		}
+
+		gzipEnabled, gzipLevel, err = parseGzipLevel(EnvOrFlag("VSIX_SERVE_GZIP_LEVEL", ""))
+		if err != nil {
+			return err
+		}
+
+		if val, found := os.LookupEnv("VSIX_SERVE_PULL_THROUGH"); found {
+			pullThroughEnabled, err = strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid value %s for VSIX_SERVE_PULL_THROUGH, expected true or false", val)
+			}
+		}
+		if val, found := os.LookupEnv("VSIX_SERVE_PULL_THROUGH_MISS_TTL"); found {
+			pullMissTTL, err = time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("invalid duration %s for VSIX_SERVE_PULL_THROUGH_MISS_TTL", val)
+			}
+		}
+
+		if val, found := os.LookupEnv("VSIX_SERVE_POLICY"); found {
+			servedExtensions, err = loadServePolicy(val)
+			if err != nil {
+				return fmt.Errorf("could not load policy from VSIX_SERVE_POLICY: %w", err)
+			}
+		}
+
+		warmEnabled := false
+		if val, found := os.LookupEnv("VSIX_SERVE_WARM"); found {
+			warmEnabled, err = strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid value %s for VSIX_SERVE_WARM, expected true or false", val)
+			}
+		}
+
+		serveReadOnly, err = flagOrEnvBool(cmd, "read-only", "VSIX_SERVE_READ_ONLY")
+		if err != nil {
+			return err
+		}
+		if serveReadOnly && pullThroughEnabled {
+			return fmt.Errorf("pull-through can not be enabled when serving read-only")
 		}
 
 		// load database of extensions
@@ -69,15 +188,37 @@ below.
 		if len(dbPath) > 0 {
 			root = dbPath
 		}
-		db, err := database.OpenFs(root, true)
+		open := database.OpenFs
+		if serveReadOnly {
+			open = database.OpenFsReadOnly
+		}
+		// printed regardless of log level, loading a large local storage takes a while and the
+		// server should not look stuck
+		fmt.Fprintf(cmd.ErrOrStderr(), "loading local storage %s, the server starts listening when it has been loaded\n", root)
+		database.LoadProgress = cmd.ErrOrStderr()
+		db, err := open(root, true)
+		database.LoadProgress = nil
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return err
+		}
+		stats := db.Stats()
+		fmt.Fprintf(cmd.ErrOrStderr(), "loaded %v extensions from local storage in %.3fs\n", stats.ExtensionCount, stats.LoadDuration.Seconds())
+		defer db.Close()
+		if warmEnabled {
+			go func() {
+				start := time.Now()
+				files, read, err := warm(db)
+				if err != nil {
+					log.Err(err).Msg("could not warm up server")
+					return
+				}
+				log.Info().Int("files", files).Int64("bytes", read).Msgf("server warmed up in %.3fs", time.Since(start).Seconds())
+			}()
 		}
 
 		stack := alice.New(
 			hlog.NewHandler(log.Logger),
-			hlog.RequestIDHandler("request_id", ""),
+			requestIDHandler,
 			hlog.MethodHandler("method"),
 			hlog.URLHandler("url"),
 			hlog.RemoteAddrHandler("remote_addr"),
@@ -92,48 +233,108 @@ below.
 		)
 
 		// setup and start server
-		http.Handle(assetRoot, stack.Then(assetHandler(db, "/"+assetRoot)))
-		http.Handle(apiRoot, stack.Then(queryHandler(db, server, assetRoot)))
+		mux := http.NewServeMux()
+		mux.Handle(assetRoot, stack.Then(assetHandler(db, assetRoot)))
+		mux.Handle(apiRoot, stack.Then(queryHandler(db, server, assetRoot)))
 
 		log.Info().Msgf("Use this server in Visual Studio Code by setting \"serviceUrl\" in the file product.json to \"%s\"", server+apiRoot[:strings.LastIndex(apiRoot, "/")])
 		log.Debug().Msgf("assets are served from %s", server+assetRoot)
 		log.Debug().Msgf("API served from %s", server+apiRoot)
 
+		serveAddr = flagOrEnv(cmd, "addr", "VSIX_SERVE_ADDR")
 		serveCert = EnvOrFlag("VSIX_CERT_FILE", serveCert)
 		serveKey = EnvOrFlag("VSIX_KEY_FILE", serveKey)
 
+		ln, err := listen(serveAddr)
+		if err != nil {
+			return fmt.Errorf("could not listen on %s: %w", serveAddr, err)
+		}
+		if serveProfile = EnvOrFlag("VSIX_SERVE_PPROF", serveProfile); serveProfile != "" {
+			if err := startProfiling(serveProfile); err != nil {
+				return fmt.Errorf("could not start profiling on %s: %w", serveProfile, err)
+			}
+			log.Warn().Str("addr", serveProfile).Msg("profiling enabled, do not expose this address publicly")
+		}
+		srv := &http.Server{Handler: mux}
+		// shut down on interrupt so the listener, and any unix socket file, is cleaned up
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-stop
+			log.Info().Str("signal", sig.String()).Msg("shutting down server")
+			if err := srv.Shutdown(context.Background()); err != nil {
+				log.Err(err).Msg("could not shut down server")
+			}
+		}()
+
 		if serveCert == "" || serveKey == "" {
 			log.Info().
+				Str("addr", serveAddr).
 				Str("cert", serveCert).
 				Str("key", serveKey).
 				Msg("Certificiate and key were not given, starting without TLS")
-			if err := http.ListenAndServe(serveAddr, nil); err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
+			err = srv.Serve(ln)
 		} else {
 			log.Info().
+				Str("addr", serveAddr).
 				Str("cert", serveCert).
 				Str("key", serveKey).
 				Msg("Certificiate and key were specified, starting with TLS")
-			if err := http.ListenAndServeTLS(serveAddr, serveCert, serveKey, nil); err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
+			err = srv.ServeTLS(ln, serveCert, serveKey)
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
 		}
+		return err
 	},
 }
 
-func EnvOrArg(env string, args []string, idx int) string {
+// EnvOrArg returns the value of the environment variable env if set, otherwise the argument
+// at index idx. An error is returned if neither is available.
+func EnvOrArg(env string, args []string, idx int) (string, error) {
 	if val, found := os.LookupEnv(env); found {
-		return val
+		return val, nil
 	}
 	if idx < len(args) {
-		return args[idx]
+		return args[idx], nil
 	}
-	fmt.Printf("%s: parameter or flag missing\n", env)
-	os.Exit(1)
-	return ""
+	return "", fmt.Errorf("%s: parameter or flag missing", env)
+}
+
+// flagOrEnv returns the value of the named flag if it was given on the command line. Otherwise
+// the value of the environment variable env is returned, if set, or the default of the flag.
+func flagOrEnv(cmd *cobra.Command, flag, env string) string {
+	if val, found := os.LookupEnv(env); found && !cmd.Flags().Changed(flag) {
+		return val
+	}
+	return cmd.Flags().Lookup(flag).Value.String()
+}
+
+// flagOrEnvBool works like flagOrEnv for boolean flags. The environment variable must be true
+// or false.
+func flagOrEnvBool(cmd *cobra.Command, flag, env string) (bool, error) {
+	val := flagOrEnv(cmd, flag, env)
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %s for %s, expected true or false", val, env)
+	}
+	return b, nil
+}
+
+// parseGzipLevel parses the compression level used when serving assets. Valid values are
+// 0-9 or off, which disables compression. An empty value returns the default level.
+func parseGzipLevel(s string) (enabled bool, level int, err error) {
+	switch strings.ToLower(s) {
+	case "":
+		return true, gzip.DefaultCompression, nil
+	case "off":
+		return false, gzip.NoCompression, nil
+	}
+	level, err = strconv.Atoi(s)
+	if err != nil || level < gzip.NoCompression || level > gzip.BestCompression {
+		return false, 0, fmt.Errorf("invalid gzip level %s, must be 0-9 or off", s)
+	}
+	return true, level, nil
 }
 
 func parseEndpoints(externalURL string) (server string, apiRoot string, assetRoot string, err error) {
@@ -165,7 +366,7 @@ func parseEndpoints(externalURL string) (server string, apiRoot string, assetRoo
 	return
 }
 
-func assetHandler(db *database.DB, assetURLPath string) http.Handler {
+func assetHandler(db *database.DB, assetRoot string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -174,8 +375,20 @@ func assetHandler(db *database.DB, assetURLPath string) http.Handler {
 			w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
 		case http.MethodGet:
 			hlog.FromRequest(r).Debug().Msgf("extracting filename from path: %s", r.URL.Path)
-			// assemble filename from request URL
-			filePath := path.Join(db.Root(), r.URL.Path[len(assetURLPath)-1:])
+			// assemble filename from request URL, the asset root is the path
+			// of the external URL followed by the asset path
+			assetPath, found := strings.CutPrefix(r.URL.Path, assetRoot)
+			if !found {
+				hlog.FromRequest(r).Debug().Str("asset_root", assetRoot).Msg("request path is not below the asset root")
+				http.NotFound(w, r)
+				return
+			}
+			if uniqueID, found := assetUniqueID(assetPath); found && !servedExtensions.allowed(uniqueID) {
+				hlog.FromRequest(r).Debug().Str("unique_id", uniqueID).Msg("extension is not allowed by policy")
+				http.NotFound(w, r)
+				return
+			}
+			filePath := path.Join(db.Root(), assetPath)
 
 			// set content type top json if returned file path is a manifest
 			if strings.Contains(filePath, "Manifest") {
@@ -192,16 +405,27 @@ func assetHandler(db *database.DB, assetURLPath string) http.Handler {
 			}
 			defer file.Close()
 
-			// return file as gzip
-			w.Header().Set("Content-Encoding", "gzip")
-			gw := gzip.NewWriter(w)
-			defer gw.Close()
+			// return file as gzip unless disabled or the file is already compressed
+			var out io.Writer = w
+			assetType := vscode.AssetTypeKey(path.Base(filePath))
+			if gzipEnabled && !slices.Contains(compressedAssetTypes, assetType) {
+				w.Header().Set("Content-Encoding", "gzip")
+				gw, err := gzip.NewWriterLevel(w, gzipLevel)
+				if err != nil {
+					serverError(w, r, fmt.Errorf("error creating gzip writer: %v", err))
+					return
+				}
+				defer gw.Close()
+				out = gw
+			}
 			hlog.FromRequest(r).Debug().Str("filePath", filePath).Msg("sending file")
-			_, err = io.Copy(gw, file)
+			_, err = io.Copy(out, file)
 			if err != nil {
 				serverError(w, r, fmt.Errorf("error transmitting file: %v", err))
 				return
 			}
+
+			markAccessed(r, db, assetPath)
 		}
 	})
 }
@@ -215,6 +439,12 @@ func queryHandler(db *database.DB, server, assetRoot string) http.Handler {
 			w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
 			return
 		case http.MethodPost:
+			apiVersion, err := negotiateAPIVersion(r.Header.Get("Accept"))
+			if err != nil {
+				hlog.FromRequest(r).Info().Err(err).Msg("unsupported API version")
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			if strings.Index(r.Header.Get("Content-Type"), "application/json") == 0 {
 				hlog.FromRequest(r).Debug().Msg("reading HTTP body")
 				b, err := io.ReadAll(r.Body)
@@ -232,7 +462,16 @@ func queryHandler(db *database.DB, server, assetRoot string) http.Handler {
 
 				debugRequest(r, query)
 
-				results, err := db.Run(query)
+				results, err := db.RunWithFilter(query, servedExtensions.allowedExtension)
+				if err == nil && pullThroughEnabled {
+					// never fetch extensions that would not be served anyway
+					names := slices.DeleteFunc(query.CriteriaValues(marketplace.FilterTypeExtensionName), func(uniqueID string) bool {
+						return !servedExtensions.allowed(uniqueID)
+					})
+					if pullThrough(r, db, names) {
+						results, err = db.RunWithFilter(query, servedExtensions.allowedExtension)
+					}
+				}
 				if err != nil {
 					if err == marketplace.ErrInvalidQuery {
 						hlog.FromRequest(r).Info().Msg("query contained in the request is not valid")
@@ -243,6 +482,13 @@ func queryHandler(db *database.DB, server, assetRoot string) http.Handler {
 					return
 				}
 				results.SetAssetEndpoint(server + assetRoot)
+				if len(query.CriteriaValues(marketplace.FilterTypeExtensionName)) > 0 || len(query.CriteriaValues(marketplace.FilterTypeExtensionID)) > 0 {
+					for _, ext := range results.Results[0].Extensions {
+						if err := db.MarkAccessed(ext); err != nil {
+							hlog.FromRequest(r).Err(err).Str("extension", ext.UniqueID()).Msg("could not record extension access")
+						}
+					}
+				}
 
 				hlog.FromRequest(r).Debug().Msg("marshaling results to JSON")
 				b, err = json.Marshal(results)
@@ -251,7 +497,7 @@ func queryHandler(db *database.DB, server, assetRoot string) http.Handler {
 					return
 				}
 
-				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.Header().Set("Content-Type", "application/json; charset=utf-8; api-version="+apiVersion)
 				hlog.FromRequest(r).Debug().Msg("sending response")
 				if _, err = io.Copy(w, bytes.NewBuffer(b)); err != nil {
 					serverError(w, r, fmt.Errorf("error while sending results: %v", err))
@@ -267,6 +513,55 @@ func queryHandler(db *database.DB, server, assetRoot string) http.Handler {
 	})
 }
 
+// defaultAPIVersion is the gallery API version used when the client does not ask for one
+const defaultAPIVersion = "3.0-preview.1"
+
+// negotiateAPIVersion returns the gallery API version requested in the api-version parameter
+// of the Accept header. The query response is the same for all 3.x versions, which are the
+// only ones supported. Without an api-version the default version is returned.
+func negotiateAPIVersion(accept string) (string, error) {
+	requested := []string{}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		for _, param := range strings.Split(mediaRange, ";") {
+			if version, found := strings.CutPrefix(strings.TrimSpace(param), "api-version="); found {
+				requested = append(requested, strings.TrimSpace(version))
+			}
+		}
+	}
+	if len(requested) == 0 {
+		return defaultAPIVersion, nil
+	}
+	for _, version := range requested {
+		if strings.HasPrefix(version, "3.") {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported api-version %s, supported versions are 3.x", strings.Join(requested, ", "))
+}
+
+// assetUniqueID returns the unique identifier of the extension the asset at assetPath belongs
+// to. The assetPath is expected to start with <publisher>/<extension name>.
+func assetUniqueID(assetPath string) (string, bool) {
+	elements := strings.Split(strings.TrimPrefix(assetPath, "/"), "/")
+	if len(elements) < 2 {
+		return "", false
+	}
+	return elements[0] + "." + elements[1], true
+}
+
+// markAccessed records that the extension, which the asset at assetPath belongs to, was served.
+// The assetPath is expected to start with <publisher>/<extension name>.
+func markAccessed(r *http.Request, db *database.DB, assetPath string) {
+	elements := strings.Split(strings.TrimPrefix(assetPath, "/"), "/")
+	if len(elements) < 2 {
+		return
+	}
+	ext := vscode.Extension{Publisher: vscode.Publisher{Name: elements[0]}, Name: elements[1]}
+	if err := db.MarkAccessed(ext); err != nil {
+		hlog.FromRequest(r).Err(err).Str("extension", ext.UniqueID()).Msg("could not record extension access")
+	}
+}
+
 func serverError(w http.ResponseWriter, r *http.Request, err error) {
 	hlog.FromRequest(r).Error().
 		Err(err).
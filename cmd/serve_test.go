@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"compress/gzip"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/cobra"
 )
 
 func TestCORSQuery(t *testing.T) {
@@ -29,6 +35,42 @@ func TestCORSQuery(t *testing.T) {
 	}
 }
 
+func TestNegotiateAPIVersion(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+		valid    bool
+	}{
+		{"", defaultAPIVersion, true},
+		{"application/json", defaultAPIVersion, true},
+		{"application/json;api-version=3.0-preview.1", "3.0-preview.1", true},
+		{"application/json; api-version=3.0", "3.0", true},
+		{"application/json;api-version=7.2-preview.1, application/json;api-version=3.0-preview.1", "3.0-preview.1", true},
+		{"application/json;api-version=7.2-preview.1", "", false},
+	}
+	for _, test := range tests {
+		version, err := negotiateAPIVersion(test.accept)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: expected valid to be %v but got error %v", test.accept, test.valid, err)
+		}
+		if version != test.expected {
+			t.Errorf("%q: expected version %q but got %q", test.accept, test.expected, version)
+		}
+	}
+
+	memdb, err := database.OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "https://www.foo.bar/testing", nil)
+	req.Header.Set("Accept", "application/json;api-version=7.2-preview.1")
+	rec := httptest.NewRecorder()
+	queryHandler(memdb, "https://www.foo.bar", "/testing").ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v for an unsupported API version but got %v", http.StatusBadRequest, rec.Code)
+	}
+}
+
 func TestCORSAsset(t *testing.T) {
 	expectedHeaders := "test,hepp"
 
@@ -116,3 +158,177 @@ func Test_URLParse(t *testing.T) {
 		}
 	}
 }
+
+func TestAssetCompression(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{
+		"golang/go/1.0.0/1234/" + string(vscode.VSIXPackage): "content",
+		"golang/go/1.0.0/1234/" + string(vscode.Manifest):    "content",
+	})
+	db, err := database.OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		assetType    vscode.AssetTypeKey
+		expectedGzip bool
+	}{
+		{vscode.VSIXPackage, false},
+		{vscode.Manifest, true},
+	}
+	handler := assetHandler(db, "/assets/")
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "https://www.foo.bar/assets/golang/go/1.0.0/1234/"+string(test.assetType), nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %v but got %v", test.assetType, http.StatusOK, rec.Code)
+		}
+		if gzipped := rec.Header().Get("Content-Encoding") == "gzip"; gzipped != test.expectedGzip {
+			t.Errorf("%s: expected gzip to be %v but was %v", test.assetType, test.expectedGzip, gzipped)
+		}
+	}
+}
+
+func TestParseGzipLevel(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedEnabled bool
+		expectedLevel   int
+		invalid         bool
+	}{
+		{"", true, gzip.DefaultCompression, false},
+		{"off", false, gzip.NoCompression, false},
+		{"OFF", false, gzip.NoCompression, false},
+		{"0", true, gzip.NoCompression, false},
+		{"9", true, gzip.BestCompression, false},
+		{"10", false, 0, true},
+		{"fast", false, 0, true},
+	}
+	for _, test := range tests {
+		enabled, level, err := parseGzipLevel(test.input)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: expected error but got none", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.input, err)
+			continue
+		}
+		if enabled != test.expectedEnabled || level != test.expectedLevel {
+			t.Errorf("%s: expected enabled=%v and level=%v but got enabled=%v and level=%v", test.input, test.expectedEnabled, test.expectedLevel, enabled, level)
+		}
+	}
+}
+
+func TestAssetPathPrefix(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{"golang/go/1.0.0/1234/" + string(vscode.VSIXPackage): "content"})
+	db, err := database.OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, _, assetRoot, err := parseEndpoints("https://www.foo.bar/vsix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := assetHandler(db, assetRoot)
+
+	tests := map[string]int{
+		server + "/vsix/assets/golang/go/1.0.0/1234/" + string(vscode.VSIXPackage): http.StatusOK,
+		server + "/assets/golang/go/1.0.0/1234/" + string(vscode.VSIXPackage):      http.StatusNotFound,
+	}
+	for url, expected := range tests {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Errorf("%s: expected status %v but got %v", url, expected, rec.Code)
+		}
+	}
+}
+
+func TestPullThrough(t *testing.T) {
+	db, err := database.OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulled := []string{}
+	defaultPull := pullExtension
+	pullExtension = func(req marketplace.ExtensionRequest, db *database.DB) FetchResult {
+		pulled = append(pulled, req.UniqueID)
+		return FetchResult{UniqueID: req.UniqueID, Err: marketplace.ErrExtensionNotFound}
+	}
+	defer func() { pullExtension = defaultPull }()
+
+	pullMisses = map[string]time.Time{}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	if pullThrough(r, db, []string{"golang.go", "redhat.java"}) {
+		t.Error("expected no extensions to be added")
+	}
+	if !slices.Equal(pulled, []string{"golang.go", "redhat.java"}) {
+		t.Errorf("expected missing extensions to be pulled, got %v", pulled)
+	}
+
+	// extensions not found are not fetched again within the TTL
+	pullThrough(r, db, []string{"golang.go"})
+	if len(pulled) != 2 {
+		t.Errorf("expected no upstream call within the TTL, got %v", pulled)
+	}
+	defaultTTL := pullMissTTL
+	pullMissTTL = 0
+	defer func() { pullMissTTL = defaultTTL }()
+	pullThrough(r, db, []string{"golang.go"})
+	if len(pulled) != 3 {
+		t.Errorf("expected upstream call after the TTL, got %v", pulled)
+	}
+}
+
+func TestServeAddrFlagOverridesEnv(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("addr", "0.0.0.0:8080", "")
+	t.Setenv("VSIX_SERVE_ADDR", ":7000")
+	if addr := flagOrEnv(cmd, "addr", "VSIX_SERVE_ADDR"); addr != ":7000" {
+		t.Errorf("expected the environment variable to be used without the flag, got %s", addr)
+	}
+	if err := cmd.Flags().Parse([]string{"--addr", ":9000"}); err != nil {
+		t.Fatal(err)
+	}
+	if addr := flagOrEnv(cmd, "addr", "VSIX_SERVE_ADDR"); addr != ":9000" {
+		t.Errorf("expected the flag to override the environment variable, got %s", addr)
+	}
+}
+
+func TestServeReadOnlyEnv(t *testing.T) {
+	tests := []struct {
+		env      string
+		args     []string
+		expected bool
+		err      bool
+	}{
+		{"true", nil, true, false},
+		{"false", nil, false, false},
+		{"yes", nil, false, true},
+		{"true", []string{"--read-only=false"}, false, false},
+		{"false", []string{"--read-only"}, true, false},
+	}
+	for _, test := range tests {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("read-only", false, "")
+		if err := cmd.Flags().Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("VSIX_SERVE_READ_ONLY", test.env)
+		readOnly, err := flagOrEnvBool(cmd, "read-only", "VSIX_SERVE_READ_ONLY")
+		if (err != nil) != test.err {
+			t.Errorf("%s %v: unexpected error %v", test.env, test.args, err)
+		}
+		if readOnly != test.expected {
+			t.Errorf("%s %v: expected read-only %v, got %v", test.env, test.args, test.expected, readOnly)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/cobra"
+)
+
+var stripKeep []string
+
+func init() {
+	dbStripCmd.Flags().StringSliceVar(&stripKeep, "keep", []string{"vsix", "manifest"}, "comma-separated list of asset types to keep")
+	dbStripCmd.Flags().BoolVar(&dry, "dry", false, "execute command without actually removing anything")
+	dbCmd.AddCommand(dbStripCmd)
+}
+
+var dbStripCmd = &cobra.Command{
+	Use:   "strip [flags]",
+	Short: "Remove asset files not needed to install extensions",
+	Long: `Remove asset files not needed to install extensions.
+
+Strip removes all asset files, for all versions in the local storage, except the
+asset types given by the keep-flag. The version metadata is updated to only list
+the kept assets. Valid asset types are:
+` + strings.Join(vscode.AssetTypeNames(), ", ") + `
+
+Visual Studio Code needs at least the vsix and manifest asset types to be able
+to install an extension, these are kept by default.
+`,
+	Example:               "  $ vsix db strip --data extensions --keep vsix,manifest,icon",
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger := log.With().Str("path", dbPath).Str("command", "strip").Logger()
+		start := time.Now()
+		keep, err := vscode.ParseAssetTypes(stripKeep)
+		if err != nil {
+			return err
+		}
+		if len(keep) == 0 {
+			return errors.New("keep can not be empty, atleast one asset type must be kept")
+		}
+		if !slices.Contains(keep, vscode.VSIXPackage) || !slices.Contains(keep, vscode.Manifest) {
+			logger.Warn().Msg("vsix and manifest asset types are not kept, extensions will not be installable")
+		}
+
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+
+		var reclaimed int64
+		for _, ext := range db.List(false) {
+			for _, v := range ext.Versions {
+				vlog := logger.With().Str("extension", ext.UniqueID()).Str("version", v.Version).Str("target_platform", v.TargetPlatform()).Logger()
+				if dry {
+					for _, a := range v.Files {
+						if !slices.Contains(keep, a.Type) {
+							vlog.Info().Str("asset_type", string(a.Type)).Msg("would be removed without dry run")
+						}
+					}
+					continue
+				}
+				size, err := db.StripAssets(ext, v, keep)
+				if err != nil {
+					vlog.Err(err).Msg("could not strip assets")
+					continue
+				}
+				reclaimed += size
+			}
+		}
+		if !dry {
+			if err := db.Modified(); err != nil {
+				logger.Err(err).Msg("could not notify server of extension update")
+			}
+		}
+		logger.Info().Msgf("reclaimed %v bytes, total time for strip %.3fs", reclaimed, time.Since(start).Seconds())
+		return nil
+	},
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripDefaults(t *testing.T) {
+	root := t.TempDir()
+	version := filepath.Join(root, "golang", "go", "1.0.0", "abc")
+	files := map[string]string{
+		"golang/go/_vsix_db_extension_metadata.json":                        `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"golang/go/1.0.0/abc/_vsix_db_version_metadata.json":                `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage":   "vsix",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Code.Manifest":          "{}",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Icons.Default": "icon",
+	}
+	writeFixture(t, root, files)
+
+	if err := executeCommand(t, nil, "db", "strip", "--data", root); err != nil {
+		t.Fatal(err)
+	}
+	for asset, kept := range map[string]bool{
+		"Microsoft.VisualStudio.Services.VSIXPackage":   true,
+		"Microsoft.VisualStudio.Code.Manifest":          true,
+		"Microsoft.VisualStudio.Services.Icons.Default": false,
+	} {
+		if _, err := os.Stat(filepath.Join(version, asset)); (err == nil) != kept {
+			t.Errorf("%s: expected kept to be %v, got %v", asset, kept, err)
+		}
+	}
+}
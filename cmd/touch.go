@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spagettikod/vsix/database"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dbCmd.AddCommand(dbTouchCmd)
+}
+
+var dbTouchCmd = &cobra.Command{
+	Use:   "touch",
+	Short: "Make a running serve-command reload the local storage",
+	Long: `Make a running serve-command reload the local storage.
+
+The serve-command watches the file .modfile in the local storage and reloads all
+extensions when it changes. The add- and update-commands update the file when
+extensions are downloaded. Use this command after changing the local storage
+in other ways, for example when copying extensions from another server.`,
+	Example:               "  $ vsix db touch --data extensions",
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		return db.Modified()
+	},
+}
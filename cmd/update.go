@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,10 +19,15 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var forceRefresh []string
+
 func init() {
 	updateCmd.Flags().StringVarP(&dbPath, "data", "d", ".", "path where downloaded extensions are stored [VSIX_DB_PATH]")
 	updateCmd.Flags().IntVar(&threads, "threads", 3, "number of simultaneous download threads")
+	updateCmd.Flags().StringSliceVar(&assetTypes, "assets", []string{}, "comma-separated list to limit which asset types to download, for example vsix,manifest")
+	updateCmd.Flags().StringVar(&runReport, "run-report", "", "write a JSON report of the outcome for each extension to this file [VSIX_RUN_REPORT]")
 	updateCmd.Flags().BoolVar(&preRelease, "pre-release", false, "update should fetch pre-release versions")
+	updateCmd.Flags().StringSliceVar(&forceRefresh, "force-refresh", []string{}, "comma-separated list of extensions to download again, overwriting existing assets, even if they are up to date")
 	rootCmd.AddCommand(updateCmd)
 }
 
@@ -32,42 +41,88 @@ Only the latest version will be downloaded each time update is run. If the exten
 has had multiple releases between each run of update those versions will not be
 downloaded.
 
-The command will exit with exit code 78 if one of the extensions can not be found
-or a given version does not exist. These errors will be logged to stderr
-output but the execution will not stop.
+The command will exit with exit code 2 if one of the extensions failed to update, for
+example if a given version does not exist. These errors will be logged to stderr
+output but the execution will not stop. Extensions that can not be found at
+Marketplace, or that have been unpublished, are logged and skipped.
 
 Target platforms
 ----------------
 Only the target platforms that exist in the local storage are updated.
 
+Asset types
+-----------
+By default all assets of the new version are downloaded. Use the assets-flag to
+limit which asset types are downloaded, see the add-command for details.
+
 Pre-releases
 ------------
 By default update skips extension versions marked as pre-release. If the latest version
 is marked as pre-release the command will traverse the list of versions until it
 finds the latest version not marked as pre-release. To enable downloading an extension
 and selecting the latest version, regardless if marked as pre-release, use the
-pre-release-flag.`,
-	Example:               `  $ vsix update --data extensions `,
+pre-release-flag.
+
+Refreshing assets
+-----------------
+Use force-refresh to download the latest version of the given extensions again even
+if the local storage already has it, for example when an asset file on disk is
+corrupt. Existing assets of the version are overwritten. Extensions not given are
+updated as usual.`,
+	Example: `  $ vsix update --data extensions
+
+  $ vsix update --data extensions --force-refresh golang.Go`,
 	DisableFlagsInUseLine: true,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if threads < 1 {
-			fmt.Println("invalid threads value, must be atleast 1 or above")
-			os.Exit(1)
+			return errors.New("invalid threads value, must be atleast 1 or above")
+		}
+		assets, err := vscode.ParseAssetTypes(assetTypes)
+		if err != nil {
+			return err
 		}
 		start := time.Now()
 		lg := log.With().Str("data_root", dbPath).Str("component", "update").Logger()
 		db, err := database.OpenFs(dbPath, false)
 		if err != nil {
-			lg.Fatal().Err(err).Msg("could not open folder")
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
 		}
 		lg.Debug().Msgf("open local extensions took %.3fs", time.Since(start).Seconds())
+		for _, uid := range forceRefresh {
+			if _, found := db.GetByUniqueID(false, uid); !found {
+				return fmt.Errorf("extension %s given to force-refresh was not found in the local storage", uid)
+			}
+		}
 		exts := db.List(true)
 
 		ers := []marketplace.ExtensionRequest{}
 		for _, ext := range exts {
 			vlog := lg.With().Str("unique_id", ext.UniqueID()).Logger()
+			if refreshRequested(forceRefresh, ext.UniqueID()) {
+				vlog.Debug().Msg("force refresh requested, adding to list of items to get")
+				ers = append(ers, marketplace.ExtensionRequest{
+					UniqueID:        ext.UniqueID(),
+					TargetPlatforms: ext.Platforms(),
+					AssetTypes:      assets,
+					PreRelease:      preRelease,
+					Force:           true,
+				})
+				continue
+			}
 			// get latest version from Marketplace
-			marketplaceLatestVersion, err := marketplace.LatestVersion(ext.UniqueID(), preRelease)
+			marketplaceLatestVersion, etag, err := marketplace.LatestVersionIfModified(ext.UniqueID(), preRelease, db.MarketplaceETag(ext, preRelease))
+			if errors.Is(err, marketplace.ErrNotModified) {
+				vlog.Debug().Msg("skipping, not modified at marketplace since last update")
+				continue
+			}
+			if errors.Is(err, marketplace.ErrExtensionUnpublished) {
+				vlog.Warn().Msg("skipping, extension has been unpublished from marketplace")
+				continue
+			}
+			if errors.Is(err, marketplace.ErrExtensionNotFound) {
+				vlog.Error().Msg("skipping, extension could not be found at marketplace")
+				continue
+			}
 			if err != nil {
 				vlog.Err(err).Msg("error while fetching latest version from marketplace")
 				continue
@@ -81,19 +136,31 @@ pre-release-flag.`,
 
 			if ext.LatestVersion(preRelease) == marketplaceLatestVersion {
 				vlog.Debug().Msg("skipping, already latest version")
+				// the ETag is only saved when we're up to date, otherwise a failed
+				// download would be skipped on the next update
+				if etag != "" {
+					if err := db.SaveMarketplaceETag(ext, etag, preRelease); err != nil {
+						vlog.Err(err).Msg("could not save marketplace ETag")
+					}
+				}
 				continue
 			} else {
 				vlog.Debug().Msg("new version exist, adding to list of items to get")
 				er := marketplace.ExtensionRequest{
 					UniqueID:        ext.UniqueID(),
 					TargetPlatforms: ext.Platforms(),
+					AssetTypes:      assets,
 					PreRelease:      preRelease,
 					Force:           force,
 				}
 				ers = append(ers, er)
 			}
 		}
-		fetchCount, errCount := fetchThreaded(db, ers, threads, lg)
+		results := fetchThreaded(db, ers, threads, true, nil, lg)
+		if err := writeRunReport(results); err != nil {
+			return err
+		}
+		fetchCount, errCount := results.Downloads(), results.Errors()
 
 		lg = lg.With().Int("downloads", fetchCount).Int("errors", errCount).Logger()
 		lg.Info().Msgf("total time for update %.3fs", time.Since(start).Seconds())
@@ -101,32 +168,57 @@ pre-release-flag.`,
 			lg.Debug().Msg("notifying server")
 			err = db.Modified()
 			if err != nil {
-				lg.Fatal().Err(err).Msg("could not notify server of extension update")
+				return fmt.Errorf("could not notify server of extension update: %w", err)
 			}
 		}
 		if errCount > 0 {
-			os.Exit(78)
+			return withExitCode(exitPartial, fmt.Errorf("%v extensions failed to update", errCount))
 		}
+		return nil
 	},
 }
 
-func fetchThreaded(db *database.DB, extensions []marketplace.ExtensionRequest, threads int, lg zerolog.Logger) (int, int) {
+// refreshRequested returns true if uniqueID is one of the unique identifiers given in ids.
+// Unique identifiers are compared case insensitive.
+func refreshRequested(ids []string, uniqueID string) bool {
+	return slices.ContainsFunc(ids, func(id string) bool {
+		return strings.EqualFold(id, uniqueID)
+	})
+}
+
+// fetchThreaded fetches the extensions using at most threads simultaneous downloads. It returns
+// the result of each processed extension. If continueOnError is false no new downloads are started
+// after the first failure. If onResult is not nil it is called as soon as an extension has been
+// processed.
+func fetchThreaded(db *database.DB, extensions []marketplace.ExtensionRequest, threads int, continueOnError bool, onResult func(FetchResult), lg zerolog.Logger) FetchResults {
+	results := FetchResults{}
 	if len(extensions) == 0 {
-		return 0, 0
+		return results
 	}
 	maxRunning := threads
 	running := 0
 	processed := sync.Map{}
 	ch := make(chan FetchResult)
 	errCount := 0
-	fetchCount := 0
+	collect := func(result FetchResult) {
+		results = append(results, result)
+		if onResult != nil {
+			onResult(result)
+		}
+		if result.Err != nil {
+			errCount++
+		}
+		running--
+	}
 	for _, ext := range extensions {
 		lg := lg.With().Str("extension_id", ext.UniqueID).Logger()
 		if running >= maxRunning {
 			lg.Debug().Msg("maximum thread count reached, waiting")
-			result := <-ch
-			fetchCount += result.Downloads
-			running--
+			collect(<-ch)
+		}
+		if errCount > 0 && !continueOnError {
+			lg.Debug().Msg("error occured, not starting any more downloads")
+			break
 		}
 		if _, found := processed.Load(ext.UniqueID); found {
 			lg.Debug().Msg("already processed, skipping")
@@ -139,15 +231,11 @@ func fetchThreaded(db *database.DB, extensions []marketplace.ExtensionRequest, t
 		lg.Debug().Msg("thread started")
 		go doFetch(ch, db, ext, lg)
 	}
-	for result := range ch {
-		fetchCount += result.Downloads
-		running--
-		if running <= 0 {
-			break
-		}
+	for running > 0 {
+		collect(<-ch)
 	}
 
-	return fetchCount, errCount
+	return results
 }
 
 func doFetch(ch chan FetchResult, db *database.DB, er marketplace.ExtensionRequest, lg zerolog.Logger) {
@@ -159,22 +247,112 @@ func doFetch(ch chan FetchResult, db *database.DB, er marketplace.ExtensionReque
 	ch <- result
 }
 
+// FetchResult is the outcome of fetching an extension, including the items of an extension pack.
 type FetchResult struct {
-	Downloads int
-	Err       error
+	UniqueID  string `json:"unique_id"`
+	Downloads int    `json:"added"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+	Bytes     int64  `json:"bytes"`
+	Err       error  `json:"-"`
+}
+
+// add adds the counts of a fetched extension pack item to the result.
+func (fr *FetchResult) add(item FetchResult) {
+	fr.Downloads += item.Downloads
+	fr.Skipped += item.Skipped
+	fr.Failed += item.Failed
+	fr.Bytes += item.Bytes
+}
+
+type FetchResults []FetchResult
+
+// writeRunReport writes the results to the run report file, if one was given.
+func writeRunReport(results FetchResults) error {
+	path := EnvOrFlag("VSIX_RUN_REPORT", runReport)
+	if path == "" {
+		return nil
+	}
+	if err := results.WriteReport(path); err != nil {
+		return fmt.Errorf("could not write run report: %w", err)
+	}
+	return nil
 }
 
-// FetchExtension downloads the extension given in the extension request from Visual Studio Code Marketplace.
-// When downloaded it is added to the database and can be served using the serve command. Besides errors
-// it returns false if the extension version already exists and no download occured. Otherwise it returns true.
+// Downloads returns the total number of downloaded versions.
+func (frs FetchResults) Downloads() int {
+	count := 0
+	for _, fr := range frs {
+		count += fr.Downloads
+	}
+	return count
+}
+
+// Errors returns the number of extensions that failed.
+func (frs FetchResults) Errors() int {
+	count := 0
+	for _, fr := range frs {
+		if fr.Err != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// WriteReport writes the results as a JSON report to the file at path.
+func (frs FetchResults) WriteReport(path string) error {
+	type entry struct {
+		FetchResult
+		Error string `json:"error,omitempty"`
+	}
+	report := []entry{}
+	for _, fr := range frs {
+		e := entry{FetchResult: fr}
+		if fr.Err != nil {
+			e.Error = fr.Err.Error()
+		}
+		report = append(report, e)
+	}
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// WriteErrorReport writes the unique identifier and error of each failed extension as a JSON
+// report to the file at path. An empty report is written if no extension failed.
+func (frs FetchResults) WriteErrorReport(path string) error {
+	type entry struct {
+		UniqueID string `json:"unique_id"`
+		Error    string `json:"error"`
+	}
+	report := []entry{}
+	for _, fr := range frs {
+		if fr.Err != nil {
+			report = append(report, entry{UniqueID: fr.UniqueID, Error: fr.Err.Error()})
+		}
+	}
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// fetchExtension downloads the extension given in the extension request from Visual Studio Code Marketplace.
+// When downloaded it is added to the database and can be served using the serve command. The result holds
+// the number of versions downloaded and any errors that occured, including failed rollbacks and extension
+// pack items that could not be fetched. It never exits the process.
 func fetchExtension(req marketplace.ExtensionRequest, db *database.DB, stack []string, compontent string) FetchResult {
-	result := FetchResult{0, nil}
+	result := FetchResult{UniqueID: req.UniqueID}
 	elog := log.With().Str("unique_id", req.UniqueID).Str("component", compontent).Logger()
 	start := time.Now()
 
-	extension, err := req.Download(preRelease)
+	extension, err := req.Download(req.PreRelease)
 	if err != nil {
-		return FetchResult{0, err}
+		result.Err = err
+		return result
 	}
 
 	if extension.IsExtensionPack() {
@@ -187,56 +365,108 @@ func fetchExtension(req marketplace.ExtensionRequest, db *database.DB, stack []s
 			itemRequest := marketplace.ExtensionRequest{
 				UniqueID:        itemUniqueID,
 				TargetPlatforms: req.TargetPlatforms,
-				PreRelease:      preRelease,
+				AssetTypes:      req.AssetTypes,
+				PreRelease:      req.PreRelease,
 				Force:           req.Force,
+				MaxAssetSize:    req.MaxAssetSize,
 			}
 			packResult := fetchExtension(itemRequest, db, append(stack, itemUniqueID), compontent)
-			result.Downloads += packResult.Downloads
+			result.add(packResult)
+			if packResult.Err != nil {
+				// record the failure but continue with the rest of the pack
+				elog.Err(packResult.Err).Str("pack_item", itemUniqueID).Msg("could not fetch extension pack item")
+				result.Err = errors.Join(result.Err, fmt.Errorf("%s: %w", itemUniqueID, packResult.Err))
+			}
 		}
 	}
 
 	if err := db.SaveExtensionMetadata(extension); err != nil {
-		return FetchResult{0, err}
+		result.Err = errors.Join(result.Err, err)
+		return result
 	}
 	elog.Debug().Msgf("extension has %v versions", len(extension.Versions))
+	// platform versions often share assets, like the changelog or icon
+	assets := newAssetCache(marketplace.OpenAsset)
 	for _, version := range extension.Versions {
 		vlog := elog.With().Str("version", version.Version).Str("version_id", version.ID()).Str("target_platform", version.TargetPlatform()).Logger()
 		if version.IsPreRelease() && !req.PreRelease && req.Version == "" {
 			vlog.Debug().Msg("skipping, version is a pre-release")
+			result.Skipped++
 			continue
 		}
 		if !req.ValidTargetPlatform(version) {
 			vlog.Debug().Msg("skipping, unwanted target platform")
+			result.Skipped++
 			continue
 		}
 		if existingVersion, found := db.GetVersion(extension.UniqueID(), version); found {
 			// if the new version is no longer in pre-release state we're replacing
 			// it with the new one
-			if !(existingVersion.IsPreRelease() && !version.IsPreRelease()) && !force {
+			if !(existingVersion.IsPreRelease() && !version.IsPreRelease()) && !req.Force {
 				vlog.Debug().Msg("skipping, version already exists")
+				result.Skipped++
 				continue
 			}
 		}
+		// only keep the requested asset types, the version metadata should
+		// reflect the assets actually stored
+		version.Files = slices.DeleteFunc(slices.Clone(version.Files), func(a vscode.Asset) bool {
+			if !req.ValidAssetType(a) {
+				vlog.Debug().Str("asset_type", string(a.Type)).Msg("skipping, unwanted asset type")
+				return true
+			}
+			return false
+		})
 		if err := db.SaveVersionMetadata(extension, version); err != nil {
-			return FetchResult{0, err}
+			result.Failed++
+			result.Err = errors.Join(result.Err, err)
+			return result
 		}
+		skipped := []vscode.AssetTypeKey{}
 		for _, asset := range version.Files {
-			b, err := asset.Download()
+			content, downloaded, err := assets.open(asset)
 			if err != nil {
 				vlog.Err(err).Str("source", asset.Source).Msg("download failed")
-				if err := db.Rollback(extension, version); err != nil {
-					vlog.Err(err).Msg("rollback failed")
-					return FetchResult{0, err}
+				if rbErr := db.Rollback(extension, version); rbErr != nil {
+					vlog.Err(rbErr).Msg("rollback failed")
+					err = errors.Join(err, fmt.Errorf("rollback failed: %w", rbErr))
 				}
-				return FetchResult{0, err}
+				result.Failed++
+				result.Err = errors.Join(result.Err, err)
+				return result
+			}
+			if !downloaded {
+				vlog.Debug().Str("source", asset.Source).Msg("reusing previously downloaded asset")
 			}
-			if err := db.SaveAssetFile(extension, version, asset, b); err != nil {
+			if size, tooLarge := assetTooLarge(req, asset, content); tooLarge {
+				vlog.Info().Str("asset_type", string(asset.Type)).Int64("size", size).Int64("max_asset_size", req.MaxAssetSize).Msg("skipping, asset is larger than the maximum asset size")
+				content.Close()
+				skipped = append(skipped, asset.Type)
+				continue
+			}
+			// SaveAssetFile rolls back the version if saving fails
+			n, err := db.SaveAssetFile(extension, version, asset, content)
+			content.Close()
+			if err != nil {
 				vlog.Err(err).Str("source", asset.Source).Msg("could not save asset file")
-				if err := db.Rollback(extension, version); err != nil {
-					vlog.Err(err).Msg("rollback failed")
-					return FetchResult{0, err}
-				}
-				return FetchResult{0, err}
+				result.Failed++
+				result.Err = errors.Join(result.Err, err)
+				return result
+			}
+			if downloaded {
+				result.Bytes += n
+			}
+			assets.saved(asset, database.AssetFile(db.Root(), extension, version, asset))
+		}
+		if len(skipped) > 0 {
+			// the version metadata should reflect the assets actually stored
+			version.Files = slices.DeleteFunc(version.Files, func(a vscode.Asset) bool {
+				return slices.Contains(skipped, a.Type)
+			})
+			if err := db.SaveVersionMetadata(extension, version); err != nil {
+				result.Failed++
+				result.Err = errors.Join(result.Err, err)
+				return result
 			}
 		}
 		vlog.Info().Msgf("version downloaded in %.3fs", time.Since(start).Seconds())
@@ -245,6 +475,61 @@ func fetchExtension(req marketplace.ExtensionRequest, db *database.DB, stack []s
 	return result
 }
 
+// assetTooLarge returns the size of the asset content and true if it is larger than the maximum
+// asset size of the request. The VSIX package is never too large, nor is content of unknown size.
+// Content is either downloaded, sized by the Content-Length reported by Marketplace, or a file
+// reused from the assetCache, sized by the file size.
+func assetTooLarge(req marketplace.ExtensionRequest, a vscode.Asset, content io.Reader) (int64, bool) {
+	if req.MaxAssetSize <= 0 || a.Is(vscode.VSIXPackage) {
+		return 0, false
+	}
+	size := marketplace.AssetSize(content)
+	if f, ok := content.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil {
+			size = fi.Size()
+		}
+	}
+	return size, size > req.MaxAssetSize
+}
+
+// assetCache remembers where downloaded assets, by source, were saved to avoid downloading
+// the same asset more than once.
+type assetCache struct {
+	download func(vscode.Asset) (io.ReadCloser, error)
+	reopen   func(path string) (io.ReadCloser, error)
+	paths    map[string]string
+}
+
+func newAssetCache(download func(vscode.Asset) (io.ReadCloser, error)) *assetCache {
+	return &assetCache{
+		download: download,
+		reopen:   func(path string) (io.ReadCloser, error) { return os.Open(path) },
+		paths:    map[string]string{},
+	}
+}
+
+// open returns a reader for the asset content, the previously saved file if the asset has been
+// saved before, otherwise the downloaded content. The returned bool is true if the asset is
+// downloaded. The caller must close the reader.
+func (c *assetCache) open(a vscode.Asset) (io.ReadCloser, bool, error) {
+	if p, found := c.paths[a.Source]; found {
+		if f, err := c.reopen(p); err == nil {
+			return f, false, nil
+		}
+		delete(c.paths, a.Source)
+	}
+	body, err := c.download(a)
+	if err != nil {
+		return nil, false, err
+	}
+	return body, true, nil
+}
+
+// saved records that the asset was saved to the file at path.
+func (c *assetCache) saved(a vscode.Asset, path string) {
+	c.paths[a.Source] = path
+}
+
 func platformsToAdd(requestedPlatforms []string, versions []vscode.Version) []string {
 	existingPlatforms := []string{}
 	for _, v := range versions {
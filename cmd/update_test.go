@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/spagettikod/vsix/database"
@@ -358,3 +362,146 @@ func TestPlatformsToAdd(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteReport(t *testing.T) {
+	results := FetchResults{
+		{UniqueID: "golang.Go", Downloads: 2, Skipped: 1, Bytes: 1024},
+		{UniqueID: "__no_real_extension", Failed: 1, Err: marketplace.ErrExtensionNotFound},
+	}
+	if results.Downloads() != 2 {
+		t.Errorf("expected 2 downloads, got %v", results.Downloads())
+	}
+	if results.Errors() != 1 {
+		t.Errorf("expected 1 error, got %v", results.Errors())
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := results.WriteReport(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := []struct {
+		UniqueID string `json:"unique_id"`
+		Added    int    `json:"added"`
+		Skipped  int    `json:"skipped"`
+		Failed   int    `json:"failed"`
+		Bytes    int64  `json:"bytes"`
+		Error    string `json:"error"`
+	}{}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 2 {
+		t.Fatalf("expected 2 report entries, got %v", len(report))
+	}
+	if report[0].UniqueID != "golang.Go" || report[0].Added != 2 || report[0].Skipped != 1 || report[0].Bytes != 1024 || report[0].Error != "" {
+		t.Errorf("unexpected first entry %+v", report[0])
+	}
+	if report[1].Failed != 1 || report[1].Error != marketplace.ErrExtensionNotFound.Error() {
+		t.Errorf("unexpected second entry %+v", report[1])
+	}
+}
+
+func TestWriteErrorReport(t *testing.T) {
+	results := FetchResults{
+		{UniqueID: "golang.Go", Downloads: 2},
+		{UniqueID: "__no_real_extension", Failed: 1, Err: marketplace.ErrExtensionNotFound},
+	}
+	path := filepath.Join(t.TempDir(), "failures.json")
+	if err := results.WriteErrorReport(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := []struct {
+		UniqueID string `json:"unique_id"`
+		Error    string `json:"error"`
+	}{}
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].UniqueID != "__no_real_extension" || report[0].Error != marketplace.ErrExtensionNotFound.Error() {
+		t.Errorf("expected only the failed extension in the report, got %+v", report)
+	}
+
+	// an empty report is written when nothing failed
+	if err := results[:1].WriteErrorReport(path); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "[]" {
+		t.Errorf("expected empty report, got %s", b)
+	}
+}
+
+func TestAssetCache(t *testing.T) {
+	downloads := 0
+	cache := newAssetCache(func(a vscode.Asset) (io.ReadCloser, error) {
+		downloads++
+		return io.NopCloser(strings.NewReader(a.Source)), nil
+	})
+	dir := t.TempDir()
+	for i, source := range []string{"https://a/icon", "https://a/changelog", "https://a/icon"} {
+		a := vscode.Asset{Source: source}
+		content, _, err := cache.open(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(content)
+		content.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != source {
+			t.Errorf("expected content %v but got %v", source, string(b))
+		}
+		p := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(p, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		cache.saved(a, p)
+	}
+	if downloads != 2 {
+		t.Errorf("expected 2 downloads but got %v", downloads)
+	}
+	content, downloaded, _ := cache.open(vscode.Asset{Source: "https://a/changelog"})
+	content.Close()
+	if downloaded {
+		t.Error("expected changelog to be reused")
+	}
+
+	// assets are downloaded again if the saved file is gone
+	if err := os.Remove(filepath.Join(dir, "1")); err != nil {
+		t.Fatal(err)
+	}
+	content, downloaded, _ = cache.open(vscode.Asset{Source: "https://a/changelog"})
+	content.Close()
+	if !downloaded {
+		t.Error("expected changelog to be downloaded when the saved file is missing")
+	}
+}
+
+func TestRefreshRequested(t *testing.T) {
+	ids := []string{"golang.Go", "ms-python.python"}
+	tests := []struct {
+		uid      string
+		expected bool
+	}{
+		{"golang.Go", true},
+		{"golang.go", true},
+		{"MS-Python.Python", true},
+		{"redhat.java", false},
+	}
+	for _, test := range tests {
+		if got := refreshRequested(ids, test.uid); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.uid, test.expected, got)
+		}
+	}
+	if refreshRequested(nil, "golang.Go") {
+		t.Error("expected false when no extensions are given")
+	}
+}
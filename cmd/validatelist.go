@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spf13/cobra"
+)
+
+var offline bool
+
+func init() {
+	validateListCmd.Flags().BoolVar(&offline, "offline", false, "only check the file format, do not look up identifiers at Marketplace")
+	rootCmd.AddCommand(validateListCmd)
+}
+
+var validateListCmd = &cobra.Command{
+	Use:   "validate-list <file>",
+	Short: "Validate an extension list file",
+	Long: `Validate an extension list file.
+
+An extension list file has one extension per line, given as the unique identifier
+optionally followed by a version. Lines starting with # are comments. A line with
+a name in brackets, like [go-dev], starts a named group, see the collection-flag of
+the add-command.
+
+Each invalid line is printed with its line number. Lines with more than two fields
+or identifiers not in the form publisher.name are invalid. Unless the offline-flag
+is given each identifier is also looked up at Marketplace and identifiers that
+can not be found are reported.
+
+The command exits with a non-zero exit code if any line is invalid.`,
+	Example:               "  $ vsix validate-list extensions.txt",
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		entries, listErrors, err := marketplace.ValidateList(data)
+		if err != nil {
+			return err
+		}
+		if !offline {
+			for _, entry := range entries {
+				log.Debug().Str("unique_id", entry.Request.UniqueID).Msg("looking up extension at Marketplace")
+				if _, err := marketplace.QueryLatestVersionByUniqueID(entry.Request.UniqueID).Run(); err != nil {
+					reason := err.Error()
+					if errors.Is(err, marketplace.ErrExtensionNotFound) {
+						reason = "unknown unique identifier"
+					}
+					listErrors = append(listErrors, marketplace.ListError{Line: entry.Line, Text: entry.Request.UniqueID, Reason: reason})
+				}
+			}
+		}
+		if len(listErrors) == 0 {
+			return nil
+		}
+		slices.SortFunc(listErrors, func(a, b marketplace.ListError) int {
+			return a.Line - b.Line
+		})
+		for _, le := range listErrors {
+			fmt.Printf("%s:%v: %s: %s\n", args[0], le.Line, le.Reason, le.Text)
+		}
+		return fmt.Errorf("found %v invalid lines in %s", len(listErrors), args[0])
+	},
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spagettikod/vsix/database"
+	"github.com/spf13/cobra"
+)
+
+var verifyAgainst string
+
+func init() {
+	dbVerifyCmd.Flags().StringVar(&verifyAgainst, "against", "", "also compare the asset files to this checksum manifest")
+	dbCmd.AddCommand(dbVerifyCmd)
+}
+
+var dbVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the files in the local storage",
+	Long: `Verify the files in the local storage.
+
+Lists problems found while loading the local storage. Extensions and versions with
+problems are not served and are not kept up to date by the update-command. Problems
+include metadata files that can not be read and metadata that does not match where
+it is stored, for example an extension stored below another publisher than the one
+in its metadata. The command exits with a non-zero exit code if any problems are found.
+
+Extensions and versions stored in the wrong folder used to be loaded, with asset paths
+pointing to files that do not exist. They are now skipped until they are moved to the
+folder given in the problem, the extension is then loaded again without having to be
+downloaded.
+
+Checksums
+---------
+Use the against-flag to also compare the asset files to a checksum manifest created by
+the db checksums-command. Files where the size or checksum differs from the manifest,
+files missing from the local storage and files not in the manifest are reported.`,
+	Example: `  $ vsix db verify --data extensions
+
+  $ vsix db verify --data extensions --against checksums.json`,
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := database.OpenFs(dbPath, false)
+		if err != nil {
+			return fmt.Errorf("could not open folder %s: %w", dbPath, err)
+		}
+		invalid := db.ValidationErrors()
+		if verifyAgainst != "" {
+			manifest, err := database.ReadChecksumsFile(verifyAgainst)
+			if err != nil {
+				return fmt.Errorf("could not read checksum manifest: %w", err)
+			}
+			mismatches, err := db.VerifyChecksums(manifest)
+			if err != nil {
+				return fmt.Errorf("could not verify checksums: %w", err)
+			}
+			invalid = append(invalid, mismatches...)
+		}
+		for _, ve := range invalid {
+			fmt.Println(ve.Error())
+		}
+		if len(invalid) > 0 {
+			return fmt.Errorf("found %v problems in %s", len(invalid), dbPath)
+		}
+		return nil
+	},
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spagettikod/vsix/marketplace"
@@ -20,15 +19,15 @@ var versionsCmd = &cobra.Command{
 	Example:               "  $ vsix versions golang.Go",
 	Args:                  cobra.MinimumNArgs(1),
 	DisableFlagsInUseLine: true,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		log.Info().Str("identifier", args[0]).Msg("looking up extension at Marketplace")
 		ext, err := marketplace.FetchExtension(args[0])
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return err
 		}
 		for _, v := range ext.Versions {
 			fmt.Println(v.Version)
 		}
+		return nil
 	},
 }
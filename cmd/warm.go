@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spagettikod/vsix/database"
+	"github.com/spagettikod/vsix/marketplace"
+	"github.com/spagettikod/vsix/vscode"
+)
+
+// warmAssetTypes are the assets Visual Studio Code requests when extensions are shown in
+// the extensions view
+var warmAssetTypes = []vscode.AssetTypeKey{vscode.IconsDefault, vscode.IconsSmall, vscode.Manifest, vscode.ContentDetails}
+
+// warm prepares the server for its first requests. It runs the query Visual Studio Code sends
+// when the extensions view is opened and reads the assets shown in the view, for the latest
+// version of all extensions, to get them into the page cache of the operating system. It
+// returns the number of files and bytes read.
+func warm(db *database.DB) (int, int64, error) {
+	q := marketplace.QueryNoCritera(marketplace.ByInstallCount)
+	q.Filters[0].PageSize = marketplace.MaximumPageSize
+	if _, err := db.RunWithFilter(q, servedExtensions.allowedExtension); err != nil {
+		return 0, 0, err
+	}
+	files, read := 0, int64(0)
+	for _, ext := range db.List(true) {
+		if !servedExtensions.allowed(ext.UniqueID()) {
+			continue
+		}
+		for _, v := range ext.Versions {
+			for _, a := range v.Files {
+				if !slices.Contains(warmAssetTypes, a.Type) {
+					continue
+				}
+				n, err := readAll(a.Path)
+				if err != nil {
+					return files, read, err
+				}
+				files++
+				read += n
+			}
+		}
+	}
+	return files, read, nil
+}
+
+// readAll reads the file at path and discards its content, returning the number of bytes read.
+func readAll(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(io.Discard, f)
+}
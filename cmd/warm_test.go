@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spagettikod/vsix/database"
+)
+
+func TestWarm(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"golang/go/_vsix_db_extension_metadata.json":                          `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"golang/go/1.0.0/abc/_vsix_db_version_metadata.json":                  `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Icons.Default":   "icon",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Code.Manifest":            "{}",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage":     "large package, not read",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Content.Details": "readme",
+	}
+	writeFixture(t, root, files)
+	db, err := database.OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, read, err := warm(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || read != int64(len("icon")+len("{}")+len("readme")) {
+		t.Errorf("expected icon, manifest and details to be read, got %v files and %v bytes", count, read)
+	}
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/afero"
+)
+
+const (
+	// accessThrottle is the minimum time between two writes of the last accessed file for
+	// the same extension, to avoid writing to disk on every request.
+	accessThrottle = time.Hour
+)
+
+// MarkAccessed records that the extension was served. The time is written at most once
+// every accessThrottle for each extension. Nothing is recorded if the database is read-only.
+func (db *DB) MarkAccessed(e vscode.Extension) error {
+	if db.readOnly {
+		return nil
+	}
+	now := time.Now()
+	key := strings.ToLower(e.UniqueID())
+	db.accessedMux.Lock()
+	if last, found := db.accessed[key]; found && now.Sub(last) < accessThrottle {
+		db.accessedMux.Unlock()
+		return nil
+	}
+	db.accessed[key] = now
+	db.accessedMux.Unlock()
+	return db.writeLastAccessed(e, now)
+}
+
+// LastAccessed returns the time the extension was last served. If the extension has never
+// been served the time it was added is returned. Extensions added before access tracking
+// existed fall back to the modification time of the extension metadata file.
+func (db *DB) LastAccessed(e vscode.Extension) (time.Time, error) {
+	b, err := afero.ReadFile(db.fs, LastAccessedFile(db.root, e))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return time.Time{}, err
+		}
+		fi, err := db.fs.Stat(ExtensionMetaFile(db.root, e))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return fi.ModTime(), nil
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+}
+
+func (db *DB) writeLastAccessed(e vscode.Extension, t time.Time) error {
+	db.dblog.Debug().Str("extension", e.UniqueID()).Time("last_accessed", t).Msg("saving last accessed file")
+	return afero.WriteFile(db.fs, LastAccessedFile(db.root, e), []byte(t.UTC().Format(time.RFC3339)), os.ModePerm)
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestLastAccessed(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := vscode.Extension{Name: "go", Publisher: vscode.Publisher{Name: "golang"}}
+	if _, err := db.LastAccessed(e); err == nil {
+		t.Error("expected error for extension that does not exist")
+	}
+
+	before := time.Now().Add(-time.Second)
+	if err := db.MarkAccessed(e); err != nil {
+		t.Fatal(err)
+	}
+	accessed, err := db.LastAccessed(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accessed.Before(before) {
+		t.Errorf("expected last accessed to be after %v but was %v", before, accessed)
+	}
+
+	// a second access within the throttle window should not write the file again
+	if err := db.writeLastAccessed(e, before.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkAccessed(e); err != nil {
+		t.Fatal(err)
+	}
+	accessed, err = db.LastAccessed(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !accessed.Before(before) {
+		t.Errorf("expected throttled access to not update last accessed, got %v", accessed)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	root := t.TempDir()
+	e := vscode.Extension{Name: "go", Publisher: vscode.Publisher{Name: "golang"}}
+	if err := os.MkdirAll(ExtensionDir(root, e), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ExtensionMetaFile(root, e), []byte(e.String()), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenFsReadOnly(root, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !db.ReadOnly() {
+		t.Error("expected database to be read-only")
+	}
+	if err := db.MarkAccessed(e); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{path.Join(root, modFilename), LastAccessedFile(root, e)} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be written, got %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spagettikod/vsix/vscode"
+)
+
+// Checksum is the size and SHA-256 checksum of an asset file in the local storage.
+type Checksum struct {
+	// Path of the file relative to the root of the local storage
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Checksums computes the checksums of all asset files of the given extensions, or of all
+// extensions in the database if none are given. Checksums are sorted by path.
+func (db *DB) Checksums(exts ...vscode.Extension) ([]Checksum, error) {
+	if len(exts) == 0 {
+		exts = db.List(false)
+	}
+	sums := []Checksum{}
+	for _, e := range exts {
+		for _, v := range e.Versions {
+			for _, a := range v.Files {
+				sum, err := db.checksum(a.Path)
+				if err != nil {
+					return nil, err
+				}
+				sums = append(sums, sum)
+			}
+		}
+	}
+	slices.SortFunc(sums, func(a, b Checksum) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return sums, nil
+}
+
+// checksum computes the checksum of the file at p.
+func (db *DB) checksum(p string) (Checksum, error) {
+	f, err := db.fs.Open(p)
+	if err != nil {
+		return Checksum{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return Checksum{}, err
+	}
+	rel, err := filepath.Rel(db.root, p)
+	if err != nil {
+		return Checksum{}, err
+	}
+	return Checksum{Path: filepath.ToSlash(rel), Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// WriteChecksums writes the checksums as JSON to w.
+func WriteChecksums(w io.Writer, sums []Checksum) error {
+	b, err := json.MarshalIndent(sums, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteChecksumsFile writes the checksums as JSON to the file at path.
+func WriteChecksumsFile(path string, sums []Checksum) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteChecksums(f, sums); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadChecksumsFile reads a checksum manifest written by WriteChecksumsFile.
+func ReadChecksumsFile(path string) ([]Checksum, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sums := []Checksum{}
+	return sums, json.Unmarshal(b, &sums)
+}
+
+// VerifyChecksums compares the asset files in the database to the checksums in manifest. Files
+// that differ, are missing or are not in the manifest are returned as validation errors with
+// the path relative to the root of the local storage.
+func (db *DB) VerifyChecksums(manifest []Checksum) ([]ValidationError, error) {
+	stored, err := db.Checksums()
+	if err != nil {
+		return nil, err
+	}
+	expected := map[string]Checksum{}
+	for _, sum := range manifest {
+		expected[sum.Path] = sum
+	}
+	invalid := []ValidationError{}
+	for _, sum := range stored {
+		exp, found := expected[sum.Path]
+		if !found {
+			invalid = append(invalid, ValidationError{Path: sum.Path, Reason: "file is not in the manifest"})
+			continue
+		}
+		delete(expected, sum.Path)
+		if exp.Size != sum.Size {
+			invalid = append(invalid, ValidationError{Path: sum.Path, Reason: fmt.Sprintf("size is %v, expected %v", sum.Size, exp.Size)})
+			continue
+		}
+		if exp.SHA256 != sum.SHA256 {
+			invalid = append(invalid, ValidationError{Path: sum.Path, Reason: "checksum does not match the manifest"})
+		}
+	}
+	for _, sum := range manifest {
+		if _, missing := expected[sum.Path]; missing {
+			invalid = append(invalid, ValidationError{Path: sum.Path, Reason: "file is missing"})
+		}
+	}
+	return invalid, nil
+}
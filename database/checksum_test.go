@@ -0,0 +1,87 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestChecksums(t *testing.T) {
+	// assets are listed from the OS file system, use a temporary directory
+	root := t.TempDir()
+	files := map[string]string{
+		"golang/go/" + extensionMetadataFileName:                          `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"golang/go/1.0.0/abc/" + versionMetadataFileName:                  `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage": "hello",
+	}
+	writeFixture(t, afero.NewOsFs(), root, files)
+	db, err := OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums, err := db.Checksums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Checksum{
+		Path:   "golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage",
+		Size:   5,
+		SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+	if len(sums) != 1 || sums[0] != expected {
+		t.Fatalf("expected %v but got %v", expected, sums)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteChecksums(buf, sums); err != nil {
+		t.Fatal(err)
+	}
+	read := []Checksum{}
+	if err := json.Unmarshal(buf.Bytes(), &read); err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 1 || read[0] != expected {
+		t.Errorf("expected manifest to contain %v but got %v", expected, read)
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"golang/go/" + extensionMetadataFileName:                            `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"golang/go/1.0.0/abc/" + versionMetadataFileName:                    `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage":   "hello",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Code.Manifest":          "{}",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Icons.Default": "icon",
+	}
+	writeFixture(t, afero.NewOsFs(), root, files)
+	db, err := OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := []Checksum{
+		// same size as the stored file but tampered with
+		{Path: "golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage", Size: 5, SHA256: "0000"},
+		{Path: "golang/go/1.0.0/abc/Microsoft.VisualStudio.Code.Manifest", Size: 2, SHA256: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},
+		{Path: "golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Content.Changelog", Size: 1, SHA256: "1111"},
+	}
+	invalid, err := db.VerifyChecksums(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage":       true, // tampered
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Icons.Default":     true, // extra
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Content.Changelog": true, // missing
+	}
+	for _, ve := range invalid {
+		if !expected[ve.Path] {
+			t.Errorf("unexpected validation error %v", ve)
+		}
+	}
+	if len(invalid) != len(expected) {
+		t.Errorf("expected %v validation errors but got %v: %v", len(expected), len(invalid), invalid)
+	}
+}
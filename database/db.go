@@ -1,15 +1,22 @@
 package database
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog"
@@ -22,22 +29,40 @@ import (
 
 const (
 	modFilename string = ".modfile"
+	// tempFilePrefix prefixes files being written, they are renamed once completely written
+	tempFilePrefix string = ".vsix_tmp_"
 )
 
 var (
 	ErrNotFound error = errors.New("query returned no results")
+	// loadProgressInterval is how often progress is logged while loading the database
+	loadProgressInterval = 2 * time.Second
+	// LoadProgress, if set, gets the progress of loading the database written to it, regardless
+	// of log level, instead of it being logged. Used to show progress while a command waits for
+	// a large local storage to load.
+	LoadProgress io.Writer
+	// TempDir, if set, is the directory asset files are downloaded to before they are moved
+	// into the local storage. By default they are downloaded to the directory of the version.
+	TempDir = ""
 )
 
 type DB struct {
 	root          string
+	itemsMux      sync.RWMutex // guards items, the indices and load statistics
 	items         []vscode.Extension
+	byUniqueID    map[string]int // lower case unique ID to index in items
+	byExtensionID map[string]int // extension ID to index in items
 	assetEndpoint string
 	loadDuration  time.Duration
 	loadedAt      time.Time
+	invalid       []ValidationError // problems found during the last load
 	modFile       string
 	watcher       *fsnotify.Watcher
 	dblog         zerolog.Logger
 	fs            afero.Fs
+	accessed      map[string]time.Time
+	accessedMux   sync.Mutex
+	readOnly      bool // nothing is written to the file system
 }
 
 type DBStats struct {
@@ -53,12 +78,17 @@ func new(root string, fs afero.Fs) (*DB, error) {
 		return nil, err
 	}
 	dblog := log.With().Str("component", "database").Str("path", absRoot).Logger()
+	_, readOnly := fs.(*afero.ReadOnlyFs)
 	return &DB{
-		root:    absRoot,
-		items:   []vscode.Extension{},
-		modFile: path.Join(root, modFilename),
-		dblog:   dblog,
-		fs:      fs,
+		root:          absRoot,
+		items:         []vscode.Extension{},
+		byUniqueID:    map[string]int{},
+		byExtensionID: map[string]int{},
+		modFile:       path.Join(root, modFilename),
+		dblog:         dblog,
+		fs:            fs,
+		accessed:      map[string]time.Time{},
+		readOnly:      readOnly,
 	}, nil
 }
 
@@ -96,6 +126,17 @@ func OpenFs(root string, autoreload bool) (*DB, error) {
 	return open(afero.NewOsFs(), root, autoreload)
 }
 
+// OpenFsReadOnly opens the database like OpenFs but never writes to the file system. Changes
+// to the local storage are only picked up by autoreload if the modfile already exists.
+func OpenFsReadOnly(root string, autoreload bool) (*DB, error) {
+	return open(afero.NewReadOnlyFs(afero.NewOsFs()), root, autoreload)
+}
+
+// ReadOnly returns true if the database never writes to the file system.
+func (db *DB) ReadOnly() bool {
+	return db.readOnly
+}
+
 // TODO remove later? only called from serve command
 func (db *DB) Root() string {
 	return db.root
@@ -107,6 +148,12 @@ func (db *DB) autoreload() (err error) {
 		Msg("checking if modfile exists")
 	_, err = db.fs.Stat(db.modFile)
 	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && db.readOnly {
+			db.dblog.Warn().
+				Str("modfile", db.modFile).
+				Msg("modfile not found and the database is read-only, changes to the local storage will not be reloaded")
+			return nil
+		}
 		if errors.Is(err, os.ErrNotExist) {
 			db.dblog.Debug().
 				Str("modfile", db.modFile).
@@ -129,7 +176,10 @@ func (db *DB) autoreload() (err error) {
 	db.watcher.Add(db.modFile)
 	go func() {
 		for {
-			<-db.watcher.Events
+			// channel is closed when the database is closed
+			if _, ok := <-db.watcher.Events; !ok {
+				return
+			}
 			db.dblog.Info().
 				Str("modfile", db.modFile).
 				Msg("database has been modified, reloading")
@@ -143,7 +193,10 @@ func (db *DB) autoreload() (err error) {
 		}
 	}()
 	go func() {
-		err := <-db.watcher.Errors
+		err, ok := <-db.watcher.Errors
+		if !ok {
+			return
+		}
 		db.dblog.Error().
 			Err(err).
 			Str("modfile", db.modFile).
@@ -152,8 +205,17 @@ func (db *DB) autoreload() (err error) {
 	return nil
 }
 
+// Close stops watching the modfile for changes. The database can still be read after it's
+// closed but it will no longer reload automatically.
+func (db *DB) Close() error {
+	if db.watcher == nil {
+		return nil
+	}
+	db.dblog.Debug().Str("modfile", db.modFile).Msg("removing watcher from modfile")
+	return db.watcher.Close()
+}
+
 func (db *DB) Reload() error {
-	db.items = []vscode.Extension{}
 	err := db.load()
 	if err != nil {
 		return err
@@ -179,17 +241,33 @@ func (db *DB) Modified() error {
 }
 
 func (db *DB) saveExtensionMetadata(e vscode.Extension) error {
-	// save extension metadata
-	// re-run query to populate statistics, list versions query does not populate statistics, is there another way?
-	eqr, err := marketplace.QueryLatestVersionByUniqueID(e.UniqueID()).Run()
-	if err != nil {
-		return err
+	newExt := e
+	// only query Marketplace if the given metadata lacks statistics
+	if len(e.Statistics) == 0 {
+		db.dblog.Debug().Str("extension", e.UniqueID()).Msg("metadata has no statistics, querying Marketplace")
+		eqr, err := marketplace.QueryLatestVersionByUniqueID(e.UniqueID()).Run()
+		if err != nil {
+			return err
+		}
+		newExt = eqr.Results[0].Extensions[0]
 	}
-	newExt := eqr.Results[0].Extensions[0]
 	newExt.Versions = []vscode.Version{}
 	if err := db.fs.MkdirAll(ExtensionDir(db.root, newExt), os.ModePerm); err != nil {
 		return err
 	}
+	// start tracking access from when the extension was first added
+	if _, err := db.fs.Stat(LastAccessedFile(db.root, newExt)); errors.Is(err, os.ErrNotExist) {
+		if err := db.writeLastAccessed(newExt, time.Now()); err != nil {
+			return err
+		}
+	}
+	if b, err := afero.ReadFile(db.fs, ExtensionMetaFile(db.root, newExt)); err == nil {
+		stored := vscode.Extension{}
+		if err := json.Unmarshal(b, &stored); err == nil && stored.Hash() == newExt.Hash() {
+			db.dblog.Debug().Str("extension", newExt.UniqueID()).Msg("metadata is unchanged, skipping write")
+			return nil
+		}
+	}
 	return afero.WriteFile(db.fs, ExtensionMetaFile(db.root, newExt), []byte(newExt.String()), os.ModePerm)
 }
 
@@ -233,26 +311,91 @@ func (db *DB) SaveVersionMetadata(e vscode.Extension, v vscode.Version) error {
 	return nil
 }
 
-func (db *DB) SaveAssetFile(e vscode.Extension, v vscode.Version, a vscode.Asset, b []byte) error {
+// SaveAssetFile saves the content of asset a, read from r, to the local storage. The content is
+// streamed to disk and never kept in memory as a whole. It returns the number of bytes written.
+// The version is rolled back if the asset could not be saved.
+func (db *DB) SaveAssetFile(e vscode.Extension, v vscode.Version, a vscode.Asset, r io.Reader) (int64, error) {
 	elog := db.dblog.With().Str("extension", e.UniqueID()).Str("extension_version", v.Version).Str("extension_version_id", v.ID()).Str("target_platform", v.RawTargetPlatform).Logger()
 	filename := AssetFile(db.root, e, v, a)
 	elog.Debug().Str("source", a.Source).Str("destination", filename).Msg("writing to file")
-	f, err := db.fs.Create(filename)
+	n, err := db.writeFile(filename, r)
 	if err != nil {
-		elog.Err(err).Str("source", a.Source).Str("destination", filename).Msg("could not create file")
-		err = db.Rollback(e, v)
-		if err != nil {
-			elog.Err(err).Msg("rollback failed")
+		elog.Err(err).Str("source", a.Source).Str("destination", filename).Msg("could not save file")
+		if rbErr := db.Rollback(e, v); rbErr != nil {
+			elog.Err(rbErr).Msg("rollback failed")
 		}
+		return n, err
+	}
+	return n, nil
+}
+
+// writeFile copies r to a temporary file and renames it to filename once completely written.
+// An interrupted write never leaves a partial file at filename that could be mistaken for a
+// complete one. The temporary file is created in TempDir, if set, otherwise in the directory of
+// filename. It returns the number of bytes written.
+func (db *DB) writeFile(filename string, r io.Reader) (int64, error) {
+	dir := path.Dir(filename)
+	if TempDir != "" {
+		dir = TempDir
+	}
+	tmp, n, err := db.writeTemp(dir, filename, r)
+	if err != nil {
+		return n, err
+	}
+	if err := db.fs.Rename(tmp, filename); err != nil {
+		if dir == path.Dir(filename) {
+			db.fs.Remove(tmp)
+			return n, err
+		}
+		// TempDir is probably on another file system, copy the file next to filename and
+		// rename it from there to keep the final step atomic
+		err = db.moveFile(tmp, filename)
+		db.fs.Remove(tmp)
+		return n, err
+	}
+	return n, nil
+}
+
+// writeTemp copies r to a new temporary file, named after filename, in dir. It returns the
+// name of the temporary file and the number of bytes written. The temporary file is removed
+// if writing fails.
+func (db *DB) writeTemp(dir, filename string, r io.Reader) (string, int64, error) {
+	f, err := afero.TempFile(db.fs, dir, tempFilePrefix+path.Base(filename)+"-*")
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		db.fs.Remove(f.Name())
+		return "", n, err
+	}
+	if err := f.Close(); err != nil {
+		db.fs.Remove(f.Name())
+		return "", n, err
+	}
+	// temporary files are only readable by the owner
+	if err := db.fs.Chmod(f.Name(), 0644); err != nil {
+		db.fs.Remove(f.Name())
+		return "", n, err
+	}
+	return f.Name(), n, nil
+}
+
+// moveFile copies the file src to a temporary file in the directory of dst and renames it
+// to dst.
+func (db *DB) moveFile(src, dst string) error {
+	f, err := db.fs.Open(src)
+	if err != nil {
 		return err
 	}
 	defer f.Close()
-	if _, err := f.Write(b); err != nil {
-		elog.Err(err).Str("source", a.Source).Str("destination", filename).Msg("could not save file")
-		err = db.Rollback(e, v)
-		if err != nil {
-			elog.Err(err).Msg("rollback failed")
-		}
+	tmp, _, err := db.writeTemp(path.Dir(dst), dst, f)
+	if err != nil {
+		return err
+	}
+	if err := db.fs.Rename(tmp, dst); err != nil {
+		db.fs.Remove(tmp)
 		return err
 	}
 	return nil
@@ -290,81 +433,287 @@ func (db *DB) GetVersion(uniqueID string, version vscode.Version) (vscode.Versio
 	return vscode.Version{}, false
 }
 
+// setItems replaces the extensions in the database and rebuilds the lookup indices. The
+// caller must hold the write lock of itemsMux.
+func (db *DB) setItems(exts []vscode.Extension) {
+	db.items = exts
+	db.byUniqueID = make(map[string]int, len(exts))
+	db.byExtensionID = make(map[string]int, len(exts))
+	for idx, e := range exts {
+		db.byUniqueID[strings.ToLower(e.UniqueID())] = idx
+		db.byExtensionID[e.ID] = idx
+	}
+}
+
+// lookup returns the extensions at the given indices in items, in the order they appear in the
+// database. Duplicate indices are only included once. The caller must hold the read lock of itemsMux.
+func (db *DB) lookup(keepLatestVersion bool, indices []int) []vscode.Extension {
+	slices.Sort(indices)
+	result := []vscode.Extension{}
+	for _, idx := range slices.Compact(indices) {
+		i := db.items[idx]
+		if keepLatestVersion {
+			i = i.KeepVersions(i.LatestVersion(true))
+		}
+		result = append(result, i.Copy())
+	}
+	return result
+}
+
 // GetByUniqueID returns a extensions matching a uniqueID. If keepLatestVersion is true only the latest
 // version is keep of all available version for returned extensions. When false all versions for an
 // extension are included. This function ignores case.
 func (db *DB) GetByUniqueID(keepLatestVersion bool, uniqueID string) (vscode.Extension, bool) {
-	normalizedUniqueID := strings.ToLower(uniqueID)
-	for _, i := range db.items {
-		if strings.ToLower(i.UniqueID()) == normalizedUniqueID {
-			if keepLatestVersion {
-				i = i.KeepVersions(i.LatestVersion(true))
-			}
-			return i.Copy(), true
-		}
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
+	idx, found := db.byUniqueID[strings.ToLower(uniqueID)]
+	if !found {
+		return vscode.Extension{}, false
 	}
-	return vscode.Extension{}, false
+	return db.lookup(keepLatestVersion, []int{idx})[0], true
 }
 
 // SearchByUniqueID returns an array of extensions matching a list of uniqueID's. If keepLatestVersion is true only the latest
 // version is keep of all available version for returned extensions. When false all versions for an extension are included.
 // This function ignores case.
 func (db *DB) SearchByUniqueID(keepLatestVersion bool, uniqueIDs ...string) []vscode.Extension {
-	queryMap := map[string]bool{}
-
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
+	indices := []int{}
 	for _, id := range uniqueIDs {
-		queryMap[strings.ToLower(id)] = true
+		if idx, found := db.byUniqueID[strings.ToLower(id)]; found {
+			indices = append(indices, idx)
+		}
 	}
+	return db.lookup(keepLatestVersion, indices)
+}
 
-	result := []vscode.Extension{}
-	for _, i := range db.items {
-		if queryMap[strings.ToLower(i.UniqueID())] {
-			if keepLatestVersion {
-				i = i.KeepVersions(i.LatestVersion(true))
+func (db *DB) FindByExtensionID(keepLatestVersion bool, ids ...string) []vscode.Extension {
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
+	indices := []int{}
+	for _, id := range ids {
+		if idx, found := db.byExtensionID[id]; found {
+			indices = append(indices, idx)
+		}
+	}
+	return db.lookup(keepLatestVersion, indices)
+}
+
+// Match controls how multiple search terms are combined when searching.
+type Match int
+
+const (
+	// MatchAny matches extensions containing at least one of the search terms.
+	MatchAny Match = iota
+	// MatchAll matches extensions containing all of the search terms.
+	MatchAll
+)
+
+// ParseMatch converts any or all to its Match.
+func ParseMatch(s string) (Match, error) {
+	switch strings.ToLower(s) {
+	case "any":
+		return MatchAny, nil
+	case "all":
+		return MatchAll, nil
+	}
+	return MatchAny, fmt.Errorf("%s is not a valid match, valid values are: any, all", s)
+}
+
+func (m Match) String() string {
+	if m == MatchAll {
+		return "all"
+	}
+	return "any"
+}
+
+// SearchOptions controls how search terms are matched against extensions.
+type SearchOptions struct {
+	Match Match
+	// Exact only matches terms equal to a whole word, instead of terms found anywhere in a field
+	Exact bool
+	// CaseSensitive only matches terms with the same case, by default case is ignored
+	CaseSensitive bool
+}
+
+// fold returns s in lower case, unless the search is case sensitive.
+func (opts SearchOptions) fold(s string) string {
+	if opts.CaseSensitive {
+		return s
+	}
+	return strings.ToLower(s)
+}
+
+// terms splits all text on space and returns the individual terms, in lower case unless the search
+// is case sensitive.
+func (opts SearchOptions) terms(text ...string) []string {
+	terms := []string{}
+	for _, t := range text {
+		terms = append(terms, strings.Fields(opts.fold(t))...)
+	}
+	return terms
+}
+
+// searchTerms splits all text on space and returns the individual lower case terms.
+func searchTerms(text ...string) []string {
+	return SearchOptions{}.terms(text...)
+}
+
+// words splits s into words, separated by any character that is not a letter or a digit.
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchesTerm returns true if the term can be found in any of the searchable fields of the extension.
+// If the search is exact the term must equal a whole word in the field.
+func matchesTerm(e vscode.Extension, term string, opts SearchOptions) bool {
+	for _, field := range []string{e.Name, e.DisplayName, e.Publisher.Name, e.ShortDescription} {
+		field = opts.fold(field)
+		if opts.Exact {
+			if slices.Contains(words(field), term) {
+				return true
 			}
-			result = append(result, i.Copy())
+			continue
+		}
+		if strings.Contains(field, term) {
+			return true
 		}
 	}
-	return result
+	return false
 }
 
-func (db *DB) FindByExtensionID(keepLatestVersion bool, ids ...string) []vscode.Extension {
-	queryMap := map[string]bool{}
+// matchesTermOrParts returns true if the term matches the extension, see matchesTerm. Terms made
+// up of several words, like remote-ssh or ms-vscode-remote.remote-ssh, also match if all of their
+// words match.
+func matchesTermOrParts(e vscode.Extension, term string, opts SearchOptions) bool {
+	if matchesTerm(e, term, opts) {
+		return true
+	}
+	parts := words(term)
+	if len(parts) < 2 {
+		return false
+	}
+	for _, part := range parts {
+		if !matchesTerm(e, part, opts) {
+			return false
+		}
+	}
+	return true
+}
 
-	for _, id := range ids {
-		queryMap[id] = true
+// matches returns true if the extension matches the terms, combined according to the given options.
+func matches(e vscode.Extension, opts SearchOptions, terms []string) bool {
+	for _, term := range terms {
+		found := matchesTermOrParts(e, term, opts)
+		if found && opts.Match == MatchAny {
+			return true
+		}
+		if !found && opts.Match == MatchAll {
+			return false
+		}
 	}
+	return opts.Match == MatchAll && len(terms) > 0
+}
 
-	result := []vscode.Extension{}
-	for _, i := range db.items {
-		if queryMap[i.ID] {
-			if keepLatestVersion {
-				i = i.KeepVersions(i.LatestVersion(true))
+// Snippet returns an excerpt, at most width characters long, of the extension description
+// around the first matched search term. Matched terms in the excerpt are enclosed in brackets.
+// If no term is found in the description the display name is used instead. An empty string is
+// returned if no term can be found in either.
+func Snippet(e vscode.Extension, width int, text ...string) string {
+	terms := searchTerms(text...)
+	for _, field := range []string{e.ShortDescription, e.DisplayName} {
+		lower := strings.ToLower(field)
+		if len(lower) != len(field) {
+			continue
+		}
+		for _, term := range terms {
+			idx := strings.Index(lower, term)
+			if idx < 0 || term == "" {
+				continue
 			}
-			result = append(result, i.Copy())
+			// center the excerpt around the first matched term
+			begin := max(0, idx-(width-len(term))/2)
+			end := min(len(field), begin+width)
+			begin = max(0, end-width)
+			// do not split multi-byte characters
+			for begin > 0 && !utf8.RuneStart(field[begin]) {
+				begin--
+			}
+			for end < len(field) && !utf8.RuneStart(field[end]) {
+				end++
+			}
+			excerpt := highlight(field[begin:end], terms)
+			if begin > 0 {
+				excerpt = "..." + excerpt
+			}
+			if end < len(field) {
+				excerpt = excerpt + "..."
+			}
+			return excerpt
 		}
 	}
-	return result
+	return ""
 }
 
-func multiContains(s string, substrs ...string) bool {
-	s = strings.ToLower(s)
-	for _, substr := range substrs {
-		substr = strings.ToLower(substr)
-		splits := strings.Split(substr, " ")
-		for _, split := range splits {
-			if strings.Contains(s, split) {
-				return true
+// highlight encloses all occurrences of the terms in s in brackets, ignoring case.
+func highlight(s string, terms []string) string {
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		// lower casing changed the byte length, indices would not match
+		return s
+	}
+	marked := make([]bool, len(s))
+	for _, term := range terms {
+		if term == "" {
+			continue
+		}
+		for offset := 0; offset < len(lower); {
+			idx := strings.Index(lower[offset:], term)
+			if idx < 0 {
+				break
+			}
+			for i := offset + idx; i < offset+idx+len(term); i++ {
+				marked[i] = true
 			}
+			offset += idx + len(term)
 		}
 	}
-	return false
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString("[")
+		}
+		b.WriteByte(s[i])
+		if marked[i] && (i == len(s)-1 || !marked[i+1]) {
+			b.WriteString("]")
+		}
+	}
+	return b.String()
 }
 
+// Search returns extensions matching any of the words in text.
 func (db *DB) Search(keepLatestVersion bool, text ...string) []vscode.Extension {
+	return db.SearchWithOptions(keepLatestVersion, SearchOptions{Match: MatchAny}, text...)
+}
+
+// SearchWithOptions returns extensions where the name, display name, publisher or description
+// matches the words in text. Words are combined according to the given options.
+func (db *DB) SearchWithOptions(keepLatestVersion bool, opts SearchOptions, text ...string) []vscode.Extension {
+	terms := opts.terms(text...)
+	db.dblog.Debug().
+		Strs("terms", terms).
+		Str("match", opts.Match.String()).
+		Bool("exact", opts.Exact).
+		Bool("case_sensitive", opts.CaseSensitive).
+		Msg("searching extensions")
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
 	result := []vscode.Extension{}
 	for _, i := range db.items {
-		if multiContains(i.Name, text...) || multiContains(i.DisplayName, text...) || multiContains(i.Publisher.Name, text...) || multiContains(i.ShortDescription, text...) {
+		if matches(i, opts, terms) {
 			if keepLatestVersion {
 				i = i.KeepVersions(i.LatestVersion(true))
 			}
@@ -377,6 +726,12 @@ func (db *DB) Search(keepLatestVersion bool, text ...string) []vscode.Extension
 // Run will execute all aspects of a marketplace.Query against the database. This includes
 // querying, sorting, limiting and paging.
 func (db *DB) Run(q marketplace.Query) (vscode.Results, error) {
+	return db.RunWithFilter(q, nil)
+}
+
+// RunWithFilter executes the query like Run but only keeps extensions for which keep returns
+// true. Extensions are filtered before counting and paging. A nil keep keeps all extensions.
+func (db *DB) RunWithFilter(q marketplace.Query, keep func(vscode.Extension) bool) (vscode.Results, error) {
 	res := vscode.NewResults()
 
 	extensions := []vscode.Extension{}
@@ -411,17 +766,21 @@ func (db *DB) Run(q marketplace.Query) (vscode.Results, error) {
 		}
 	}
 
+	if keep != nil {
+		extensions = slices.DeleteFunc(extensions, func(e vscode.Extension) bool {
+			return !keep(e)
+		})
+	}
+
 	// set total count to all extensions found, before some might be removed if paginated
 	res.SetTotalCount(len(extensions))
 
 	// sort the result
-	switch q.SortBy() {
-	case marketplace.ByInstallCount:
-		sort.Sort(vscode.ByPopularity(extensions))
-	}
+	SortExtensions(extensions, q.SortBy(), q.SortOrder())
 
-	// paginate
-	begin, end := pageBoundaries(len(extensions), q.Filters[0].PageSize, q.Filters[0].PageNumber)
+	// paginate, never return more than what Marketplace would
+	pageSize := min(q.Filters[0].PageSize, marketplace.MaximumPageSize)
+	begin, end := pageBoundaries(len(extensions), pageSize, q.Filters[0].PageNumber)
 
 	// add sorted and paginated extensions to the result
 	res.AddExtensions(extensions[begin:end])
@@ -429,22 +788,53 @@ func (db *DB) Run(q marketplace.Query) (vscode.Results, error) {
 	return res, nil
 }
 
+// SortExtensions sorts exts by the sort criteria in the given order. Installs, rating and published
+// date are sorted in descending order and name in ascending order, unless another order is given.
+// Extensions are left in their current order when sorting by ByNone.
+func SortExtensions(exts []vscode.Extension, sortBy marketplace.SortCriteria, order marketplace.SortOrder) {
+	var compare func(a, b vscode.Extension) int
+	switch sortBy {
+	case marketplace.ByInstallCount:
+		compare = func(a, b vscode.Extension) int { return cmp.Compare(b.InstallCount(), a.InstallCount()) }
+	case marketplace.ByRating:
+		compare = func(a, b vscode.Extension) int { return cmp.Compare(b.AverageRating(), a.AverageRating()) }
+	case marketplace.ByPublishedDate:
+		compare = func(a, b vscode.Extension) int { return b.PublishedDate.Compare(a.PublishedDate) }
+	case marketplace.ByName:
+		compare = func(a, b vscode.Extension) int { return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) }
+	default:
+		return
+	}
+	reverse := order == marketplace.SortAscending
+	if sortBy == marketplace.ByName {
+		reverse = order == marketplace.SortDescending
+	}
+	slices.SortStableFunc(exts, func(a, b vscode.Extension) int {
+		if reverse {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+}
+
 // pageBoundaries return the begin and end index for a given page size and page. Indices
 // can be used when slicing arrays/slices.
 func pageBoundaries(totalCount, pageSize, pageNumber int) (begin, end int) {
 	if pageNumber < 1 {
 		pageNumber = 1
 	}
-	begin = ((pageNumber - 1) * pageSize)
-	end = begin + pageSize
-	if end > totalCount {
-		end = totalCount
+	if pageSize < 0 {
+		pageSize = 0
 	}
+	begin = min((pageNumber-1)*pageSize, totalCount)
+	end = min(begin+pageSize, totalCount)
 	return
 }
 
 // String dumps the entire database as a JSON string.
 func (db *DB) String() string {
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
 	b, err := json.MarshalIndent(db.items, "", "   ")
 	if err != nil {
 		return "! JSON UNMARSHAL FAILED !"
@@ -454,11 +844,15 @@ func (db *DB) String() string {
 
 // Empty returns true if the database has no entries, otherwise false.
 func (db *DB) Empty() bool {
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
 	return len(db.items) == 0
 }
 
 // List return all entries in the database.
 func (db *DB) List(keepLatestVersion bool) []vscode.Extension {
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
 	result := []vscode.Extension{}
 	for _, e := range db.items {
 		if keepLatestVersion {
@@ -471,6 +865,8 @@ func (db *DB) List(keepLatestVersion bool) []vscode.Extension {
 
 // Stats return some statistics about the database.
 func (db *DB) Stats() DBStats {
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
 	stats := DBStats{
 		LoadDuration: db.loadDuration,
 	}
@@ -481,8 +877,8 @@ func (db *DB) Stats() DBStats {
 	return stats
 }
 
-func (db *DB) sortVersions() {
-	for _, item := range db.items {
+func sortVersions(exts []vscode.Extension) {
+	for _, item := range exts {
 		sort.Slice(item.Versions, func(i, j int) bool {
 			return semver.Compare("v"+item.Versions[i].Version, "v"+item.Versions[j].Version) > 0
 		})
@@ -493,14 +889,33 @@ func (db *DB) load() error {
 	start := time.Now()
 	db.dblog.Debug().Msg("loading database")
 	exts := []vscode.Extension{}
-	for _, extensionRoot := range db.listExtensions() {
+	invalid := []ValidationError{}
+	extensionRoots := db.listExtensions()
+	lastProgress := start
+	for i, extensionRoot := range extensionRoots {
+		// large storages take a while to load, let the user know we're not stuck
+		if time.Since(lastProgress) >= loadProgressInterval {
+			if LoadProgress != nil {
+				fmt.Fprintf(LoadProgress, "loading local storage, %v of %v extensions loaded\n", i, len(extensionRoots))
+			} else {
+				db.dblog.Info().Int("loaded", i).Int("total", len(extensionRoots)).Msgf("loading database, %v of %v extensions loaded", i, len(extensionRoots))
+			}
+			lastProgress = time.Now()
+		}
 		db.dblog.Debug().Str("path", extensionRoot).Msg("loading extension")
 		ext, err := db.loadExtension(extensionRoot)
 		if err != nil {
 			db.dblog.Error().Err(err).Str("path", extensionRoot).Msg("error while loading extension, skipping")
+			invalid = append(invalid, ValidationError{Path: extensionRoot, Reason: fmt.Sprintf("could not load extension metadata: %v", err)})
+			continue
+		}
+		if expected := ExtensionDir(db.root, ext); expected != extensionRoot {
+			db.dblog.Error().Str("path", extensionRoot).Str("expected_path", expected).Msg("extension metadata does not match its location, skipping")
+			invalid = append(invalid, ValidationError{Path: extensionRoot, Reason: fmt.Sprintf("metadata is for %s which belongs in %s", ext.UniqueID(), expected)})
 			continue
 		}
-		versions, _ := db.listVersions(ext)
+		versions, invalidVersions := db.listVersions(ext)
+		invalid = append(invalid, invalidVersions...)
 		if len(versions) == 0 {
 			// db.dblog.Info().Str("path", extensionRoot).Msg("extension does not have any versions, skipping")
 			db.dblog.Info().Str("path", extensionRoot).Msg("extension does not have any versions")
@@ -517,12 +932,16 @@ func (db *DB) load() error {
 		}
 		exts = append(exts, ext)
 	}
-	db.items = exts
-	db.sortVersions()
+	sortVersions(exts)
 
+	// readers keep using the previous items until the new ones are in place
+	db.itemsMux.Lock()
+	db.setItems(exts)
+	db.invalid = invalid
 	db.loadDuration = time.Since(start)
 	db.loadedAt = time.Now()
-	db.dblog.Debug().Msgf("loading database took %.3fs", db.loadDuration.Seconds())
+	db.itemsMux.Unlock()
+	db.dblog.Debug().Msgf("loading database took %.3fs", time.Since(start).Seconds())
 	return nil
 }
 
@@ -540,18 +959,18 @@ func (db *DB) listExtensions() []string {
 	return files
 }
 
-func (db *DB) listVersions(ext vscode.Extension) ([]vscode.Version, []string) {
+func (db *DB) listVersions(ext vscode.Extension) ([]vscode.Version, []ValidationError) {
 	db.dblog.Debug().Str("path", ext.Path).Msg("list extension versions")
 	matches, _ := afero.Glob(afero.NewBasePathFs(db.fs, ext.Path), "*/*")
 	// matches, _ := fs.Glob(os.DirFS(ext.Path), "*/*")
 	versions := []vscode.Version{}
-	erroneousVersionRoots := []string{}
+	invalid := []ValidationError{}
 	for _, m := range matches {
 		versionRoot := path.Join(ext.Path, m)
 		fi, err := db.fs.Stat(versionRoot)
 		if err != nil {
 			db.dblog.Error().Err(err).Str("path", ext.Path).Msg("error while loading version, skipping")
-			erroneousVersionRoots = append(erroneousVersionRoots, versionRoot)
+			invalid = append(invalid, ValidationError{Path: versionRoot, Reason: err.Error()})
 			continue
 		}
 		if fi.IsDir() {
@@ -561,12 +980,17 @@ func (db *DB) listVersions(ext vscode.Extension) ([]vscode.Version, []string) {
 			b, err := afero.ReadFile(db.fs, metafile)
 			if err != nil {
 				db.dblog.Error().Err(err).Str("path", ext.Path).Msg("error while loading version, skipping")
-				erroneousVersionRoots = append(erroneousVersionRoots, versionRoot)
+				invalid = append(invalid, ValidationError{Path: versionRoot, Reason: fmt.Sprintf("could not read version metadata: %v", err)})
 				continue
 			}
 			if err := json.Unmarshal(b, &v); err != nil {
 				db.dblog.Error().Err(err).Str("path", ext.Path).Msg("error while loading version, skipping")
-				erroneousVersionRoots = append(erroneousVersionRoots, versionRoot)
+				invalid = append(invalid, ValidationError{Path: versionRoot, Reason: fmt.Sprintf("could not parse version metadata: %v", err)})
+				continue
+			}
+			if expected := VersionDir(db.root, ext, v); expected != versionRoot {
+				db.dblog.Error().Str("path", versionRoot).Str("expected_path", expected).Msg("version metadata does not match its location, skipping")
+				invalid = append(invalid, ValidationError{Path: versionRoot, Reason: fmt.Sprintf("metadata is for version %s which belongs in %s", v.Version, expected)})
 				continue
 			}
 			versions = append(versions, v)
@@ -574,7 +998,7 @@ func (db *DB) listVersions(ext vscode.Extension) ([]vscode.Version, []string) {
 			db.dblog.Debug().Str("file", m).Msg("not a directory, skipping")
 		}
 	}
-	return versions, erroneousVersionRoots
+	return versions, invalid
 }
 
 func (db *DB) loadExtension(extensionRoot string) (vscode.Extension, error) {
@@ -601,6 +1025,11 @@ func (db *DB) listAssets(versionRoot string) []string {
 		if m == "_vsix_db_version_metadata.json" {
 			continue
 		}
+		if strings.HasPrefix(m, tempFilePrefix) {
+			// left behind by an interrupted write
+			db.dblog.Debug().Str("path", versionRoot).Str("file", m).Msg("skipping temporary file")
+			continue
+		}
 		db.dblog.Debug().Str("path", versionRoot).Str("asset", m).Msg("found asset")
 		files = append(files, path.Join(versionRoot, m))
 	}
@@ -625,6 +1054,72 @@ func (db *DB) versionAssets(versionRoot string) []vscode.Asset {
 	return assets
 }
 
+// AssetSize returns the size in bytes of the asset file in the local storage.
+func (db *DB) AssetSize(a vscode.Asset) (int64, error) {
+	fi, err := db.fs.Stat(a.Path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// StripAssets removes the asset files of version v that are not among the asset types in keep. The
+// version metadata file is updated to only list the kept assets. It returns the number of bytes removed.
+func (db *DB) StripAssets(e vscode.Extension, v vscode.Version, keep []vscode.AssetTypeKey) (int64, error) {
+	elog := db.dblog.With().Str("extension", e.UniqueID()).Str("extension_version", v.Version).Str("extension_version_id", v.ID()).Str("target_platform", v.RawTargetPlatform).Logger()
+	var removed int64
+	for _, a := range v.Files {
+		if slices.Contains(keep, a.Type) {
+			continue
+		}
+		fi, err := db.fs.Stat(a.Path)
+		if err != nil {
+			return removed, err
+		}
+		elog.Debug().Str("asset_type", string(a.Type)).Str("path", a.Path).Msg("removing asset file")
+		if err := db.fs.Remove(a.Path); err != nil {
+			return removed, err
+		}
+		removed += fi.Size()
+	}
+
+	metafile := VersionMetaFile(db.root, e, v)
+	b, err := afero.ReadFile(db.fs, metafile)
+	if err != nil {
+		return removed, err
+	}
+	meta := vscode.Version{}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return removed, err
+	}
+	meta.Files = slices.DeleteFunc(meta.Files, func(a vscode.Asset) bool {
+		return !slices.Contains(keep, a.Type)
+	})
+	elog.Debug().Msg("updating version metadata file")
+	return removed, afero.WriteFile(db.fs, metafile, []byte(meta.String()), os.ModePerm)
+}
+
+// DeleteExtension removes the extension and all of its versions. The extension metadata file
+// is removed last, if removal fails half way the extension is still found in the database and
+// removing it can be retried.
+func (db *DB) DeleteExtension(e vscode.Extension) error {
+	db.dblog.Info().Str("extension", e.UniqueID()).Msg("removing extension")
+	dir := ExtensionDir(db.root, e)
+	entries, err := afero.ReadDir(db.fs, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == extensionMetadataFileName {
+			continue
+		}
+		if err := db.fs.RemoveAll(path.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return db.fs.RemoveAll(dir)
+}
+
 func (db *DB) DeleteVersion(e vscode.Extension, v vscode.Version) error {
 	db.dblog.Info().Str("extension", e.UniqueID()).Str("version", v.Version).Msg("removing version")
 	return os.RemoveAll(path.Dir(v.Path))
@@ -1,10 +1,20 @@
 package database
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/spagettikod/vsix/marketplace"
 	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/afero"
 )
 
 var (
@@ -38,6 +48,21 @@ func isTestExtension(ext vscode.Extension, version string) bool {
 	return false
 }
 
+// writeFixture writes files, mapping a path relative to root to its content, to fs. Folders are
+// created as needed.
+func writeFixture(t testing.TB, fs afero.Fs, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := path.Join(root, name)
+		if err := fs.MkdirAll(path.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := afero.WriteFile(fs, p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestIntegrationTests(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration tests when -test.short")
@@ -72,11 +97,13 @@ func TestIntegrationTests(t *testing.T) {
 				t.Fatal(err)
 			}
 			for _, a := range v.Files {
-				b, err := a.Download()
+				content, err := marketplace.OpenAsset(a)
 				if err != nil {
 					t.Fatal(err)
 				}
-				if err := memdb.SaveAssetFile(extension, v, a, b); err != nil {
+				_, err = memdb.SaveAssetFile(extension, v, a, content)
+				content.Close()
+				if err != nil {
 					t.Fatal(err)
 				}
 			}
@@ -318,6 +345,9 @@ func TestPageBoundaries(t *testing.T) {
 		{123, 50, 1, 0, 50},
 		{123, 50, 2, 50, 100},
 		{123, 50, 3, 100, 123},
+		{123, 50, 4, 123, 123},
+		{123, 0, 1, 0, 0},
+		{123, -1, 1, 0, 0},
 	}
 	for _, v := range tests {
 		begin, end := pageBoundaries(v.totalCount, v.pageSize, v.page)
@@ -326,3 +356,658 @@ func TestPageBoundaries(t *testing.T) {
 		}
 	}
 }
+
+func TestStripAssets(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := vscode.Extension{Name: "go", Publisher: vscode.Publisher{Name: "golang"}}
+	v := vscode.Version{
+		Version:  "1.0.0",
+		AssetURI: "https://golang.gallerycdn.vsassets.io/extensions/golang/go/1.0.0/1234",
+		Files: []vscode.Asset{
+			{Type: vscode.VSIXPackage},
+			{Type: vscode.Manifest},
+			{Type: vscode.ContentChangelog},
+		},
+	}
+	if err := db.SaveVersionMetadata(e, v); err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range v.Files {
+		if _, err := db.SaveAssetFile(e, v, a, strings.NewReader("content")); err != nil {
+			t.Fatal(err)
+		}
+		v.Files[i].Path = AssetFile(db.root, e, v, a)
+	}
+
+	removed, err := db.StripAssets(e, v, []vscode.AssetTypeKey{vscode.VSIXPackage, vscode.Manifest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != int64(len("content")) {
+		t.Errorf("expected %v bytes to be removed but got %v", len("content"), removed)
+	}
+	for _, a := range v.Files {
+		_, err := db.fs.Stat(a.Path)
+		if a.Is(vscode.ContentChangelog) && err == nil {
+			t.Errorf("expected %v to be removed", a.Type)
+		}
+		if !a.Is(vscode.ContentChangelog) && err != nil {
+			t.Errorf("expected %v to be kept, got: %v", a.Type, err)
+		}
+	}
+
+	b, err := afero.ReadFile(db.fs, VersionMetaFile(db.root, e, v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := vscode.Version{}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Files) != 2 {
+		t.Errorf("expected version metadata to list 2 assets but got %v", len(meta.Files))
+	}
+}
+
+func TestRunPageSize(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exts := []vscode.Extension{}
+	for i := 0; i < marketplace.MaximumPageSize+10; i++ {
+		exts = append(exts, vscode.Extension{ID: fmt.Sprint(i)})
+	}
+	db.setItems(exts)
+	q := marketplace.NewQuery()
+	q.Filters[0].PageSize = marketplace.MaximumPageSize * 2
+	res, err := db.Run(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results[0].Extensions) != marketplace.MaximumPageSize {
+		t.Errorf("expected %v extensions but got %v", marketplace.MaximumPageSize, len(res.Results[0].Extensions))
+	}
+	if res.Results[0].ResultMetadata[0].MetadataItems[0].Count != marketplace.MaximumPageSize+10 {
+		t.Errorf("expected total count %v but got %v", marketplace.MaximumPageSize+10, res.Results[0].ResultMetadata[0].MetadataItems[0].Count)
+	}
+
+	q.Filters[0].PageNumber = 10
+	res, err = db.Run(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results[0].Extensions) != 0 {
+		t.Errorf("expected no extensions for a page past the end but got %v", len(res.Results[0].Extensions))
+	}
+}
+
+func TestSearchMatch(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.setItems([]vscode.Extension{
+		{Name: "vscode-docker", ShortDescription: "Makes it easy to create, manage, and debug containerized applications."},
+		{Name: "vscode-kubernetes-tools", ShortDescription: "Develop, deploy and debug Kubernetes applications, including docker images"},
+		{Name: "go", ShortDescription: "Rich Go language support for Visual Studio Code"},
+	})
+	tests := []struct {
+		match    Match
+		text     []string
+		expected int
+	}{
+		{MatchAny, []string{"docker", "kubernetes"}, 2},
+		{MatchAll, []string{"docker", "kubernetes"}, 1},
+		{MatchAll, []string{"docker kubernetes"}, 1},
+		{MatchAny, []string{"Go"}, 1},
+		{MatchAll, []string{"docker", "golang"}, 0},
+		{MatchAll, []string{}, 0},
+	}
+	for _, test := range tests {
+		result := db.SearchWithOptions(false, SearchOptions{Match: test.match}, test.text...)
+		if len(result) != test.expected {
+			t.Errorf("%v (match %v): expected %v extensions but got %v", test.text, test.match, test.expected, len(result))
+		}
+	}
+}
+
+func TestSearchExact(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.setItems([]vscode.Extension{
+		{Name: "go", ShortDescription: "Rich Go language support for Visual Studio Code"},
+		{Name: "golang-tools", ShortDescription: "Tools for golang"},
+	})
+	tests := []struct {
+		exact    bool
+		text     string
+		expected int
+	}{
+		{false, "go", 2},
+		{true, "go", 1},
+		{true, "GOLANG", 1},
+		{true, "tools", 1},
+		{true, "tool", 0},
+	}
+	for _, test := range tests {
+		result := db.SearchWithOptions(false, SearchOptions{Match: MatchAny, Exact: test.exact}, test.text)
+		if len(result) != test.expected {
+			t.Errorf("%v (exact %v): expected %v extensions but got %v", test.text, test.exact, test.expected, len(result))
+		}
+	}
+}
+
+func TestSortExtensions(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	installs := func(n float32) []vscode.Statistic {
+		return []vscode.Statistic{{Name: string(vscode.StatisticInstall), Value: n}}
+	}
+	exts := []vscode.Extension{
+		{Name: "b", PublishedDate: day(2), Statistics: installs(30)},
+		{Name: "c", PublishedDate: day(1), Statistics: installs(10)},
+		{Name: "a", PublishedDate: day(3), Statistics: installs(20)},
+	}
+	names := func(exts []vscode.Extension) string {
+		s := ""
+		for _, e := range exts {
+			s += e.Name
+		}
+		return s
+	}
+	tests := []struct {
+		sortBy   marketplace.SortCriteria
+		order    marketplace.SortOrder
+		expected string
+	}{
+		{marketplace.ByNone, marketplace.SortAscending, "bca"},
+		{marketplace.ByInstallCount, marketplace.SortDefault, "bac"},
+		{marketplace.ByInstallCount, marketplace.SortAscending, "cab"},
+		{marketplace.ByPublishedDate, marketplace.SortDefault, "abc"},
+		{marketplace.ByPublishedDate, marketplace.SortAscending, "cba"},
+		{marketplace.ByName, marketplace.SortDefault, "abc"},
+		{marketplace.ByName, marketplace.SortDescending, "cba"},
+	}
+	for _, test := range tests {
+		sorted := slices.Clone(exts)
+		SortExtensions(sorted, test.sortBy, test.order)
+		if got := names(sorted); got != test.expected {
+			t.Errorf("sort by %v, order %v: expected %s, got %s", test.sortBy, test.order, test.expected, got)
+		}
+	}
+}
+
+func TestSearchCaseSensitive(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.setItems([]vscode.Extension{
+		{Name: "prettier-vscode", DisplayName: "Prettier - Code formatter"},
+		{Name: "pretty-ts-errors", ShortDescription: "Make TypeScript errors prettier"},
+	})
+	tests := []struct {
+		caseSensitive bool
+		exact         bool
+		text          string
+		expected      int
+	}{
+		{false, false, "Prettier", 2},
+		{false, true, "PRETTIER", 2},
+		{true, false, "Prettier", 1},
+		{true, false, "prettier", 2},
+		{true, true, "Prettier", 1},
+		{true, false, "PRETTIER", 0},
+	}
+	for _, test := range tests {
+		result := db.SearchWithOptions(false, SearchOptions{Match: MatchAny, Exact: test.exact, CaseSensitive: test.caseSensitive}, test.text)
+		if len(result) != test.expected {
+			t.Errorf("%v (case sensitive %v, exact %v): expected %v extensions but got %v", test.text, test.caseSensitive, test.exact, test.expected, len(result))
+		}
+	}
+}
+
+func TestSearchHyphenated(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.setItems([]vscode.Extension{
+		{Name: "remote-ssh", Publisher: vscode.Publisher{Name: "ms-vscode-remote"}, DisplayName: "Remote - SSH"},
+		{Name: "remote-containers", Publisher: vscode.Publisher{Name: "ms-vscode-remote"}, DisplayName: "Dev Containers"},
+		{Name: "ssh-tools", ShortDescription: "Remote helpers"},
+	})
+	tests := []struct {
+		exact    bool
+		text     string
+		expected int
+	}{
+		{false, "remote-ssh", 2},
+		{true, "remote-ssh", 2},
+		{false, "ms-vscode-remote.remote-ssh", 1},
+		{true, "ms-vscode-remote.remote-ssh", 1},
+		{true, "remote-tools", 1},
+		{true, "containers-ssh", 0},
+	}
+	for _, test := range tests {
+		result := db.SearchWithOptions(false, SearchOptions{Match: MatchAll, Exact: test.exact}, test.text)
+		if len(result) != test.expected {
+			t.Errorf("%v (exact %v): expected %v extensions but got %v", test.text, test.exact, test.expected, len(result))
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	e := vscode.Extension{
+		DisplayName:      "Docker",
+		ShortDescription: "Makes it easy to create, manage, and debug containerized applications.",
+	}
+	tests := []struct {
+		width    int
+		text     []string
+		expected string
+	}{
+		{100, []string{"debug"}, "Makes it easy to create, manage, and [debug] containerized applications."},
+		{100, []string{"Debug create"}, "Makes it easy to [create], manage, and [debug] containerized applications."},
+		{20, []string{"debug"}, "...e, and [debug] contain..."},
+		{10, []string{"makes"}, "[Makes] it e..."},
+		{100, []string{"docker"}, "[Docker]"},
+		{100, []string{"golang"}, ""},
+	}
+	for _, test := range tests {
+		actual := Snippet(e, test.width, test.text...)
+		if actual != test.expected {
+			t.Errorf("%v: expected %q but got %q", test.text, test.expected, actual)
+		}
+	}
+}
+
+// indexTestDB returns a database with count extensions named ext0..extN from publisher pub.
+func indexTestDB(t testing.TB, count int) *DB {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exts := []vscode.Extension{}
+	for i := 0; i < count; i++ {
+		exts = append(exts, vscode.Extension{ID: fmt.Sprintf("id-%v", i), Name: fmt.Sprintf("ext%v", i), Publisher: vscode.Publisher{Name: "pub"}})
+	}
+	db.setItems(exts)
+	return db
+}
+
+func TestIndexLookup(t *testing.T) {
+	db := indexTestDB(t, 10)
+	if ext, found := db.GetByUniqueID(false, "PUB.ext3"); !found || ext.ID != "id-3" {
+		t.Errorf("expected to find id-3 ignoring case, got %v %v", ext.ID, found)
+	}
+	if _, found := db.GetByUniqueID(false, "pub.ext10"); found {
+		t.Error("did not expect to find pub.ext10")
+	}
+	// results keep database order and duplicates are removed
+	exts := db.SearchByUniqueID(false, "pub.ext5", "pub.ext1", "pub.ext5", "pub.missing")
+	if len(exts) != 2 || exts[0].ID != "id-1" || exts[1].ID != "id-5" {
+		t.Errorf("unexpected search result %v", exts)
+	}
+	exts = db.FindByExtensionID(false, "id-7", "id-2")
+	if len(exts) != 2 || exts[0].ID != "id-2" || exts[1].ID != "id-7" {
+		t.Errorf("unexpected find result %v", exts)
+	}
+}
+
+func BenchmarkGetByUniqueID(b *testing.B) {
+	db := indexTestDB(b, 50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.GetByUniqueID(false, fmt.Sprintf("pub.ext%v", i%50000))
+	}
+}
+
+func BenchmarkFindByExtensionID(b *testing.B) {
+	db := indexTestDB(b, 50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.FindByExtensionID(false, fmt.Sprintf("id-%v", i%50000))
+	}
+}
+
+func TestClose(t *testing.T) {
+	db, err := OpenFs(t.TempDir(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// closing twice or closing a database without autoreload should not fail
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mem, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentReload(t *testing.T) {
+	db := indexTestDB(t, 100)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 50; i++ {
+			if err := db.Reload(); err != nil {
+				t.Error(err)
+			}
+		}
+		done <- true
+	}()
+	for i := 0; i < 50; i++ {
+		db.GetByUniqueID(false, "pub.ext1")
+		db.List(true)
+		db.Stats()
+	}
+	<-done
+}
+
+// failingRemoveFs fails to remove the path failOn.
+type failingRemoveFs struct {
+	afero.Fs
+	failOn string
+}
+
+func (f failingRemoveFs) RemoveAll(p string) error {
+	if p == f.failOn {
+		return fmt.Errorf("could not remove %s", p)
+	}
+	return f.Fs.RemoveAll(p)
+}
+
+func TestDeleteExtensionFailure(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	e := vscode.Extension{Name: "go", Publisher: vscode.Publisher{Name: "golang"}}
+	if err := afero.WriteFile(mem, ExtensionMetaFile("/data", e), []byte(e.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	versionDir := ExtensionDir("/data", e) + "/1.0.0"
+	if err := afero.WriteFile(mem, versionDir+"/abc/"+versionMetadataFileName, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := open(failingRemoveFs{Fs: mem, failOn: versionDir}, "/data", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteExtension(e); err == nil {
+		t.Fatal("expected removal to fail")
+	}
+	if err := db.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := db.GetByUniqueID(false, "golang.go"); !found {
+		t.Fatal("expected extension to remain in the database after failed removal")
+	}
+
+	db.fs = mem
+	if err := db.DeleteExtension(e); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := afero.DirExists(mem, ExtensionDir("/data", e)); exists {
+		t.Error("expected extension directory to be removed on retry")
+	}
+}
+
+func TestSaveExtensionMetadataWithStatistics(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := vscode.Extension{
+		Name:       "go",
+		Publisher:  vscode.Publisher{Name: "golang"},
+		Statistics: []vscode.Statistic{{Name: string(vscode.StatisticInstall), Value: 10}},
+		Versions:   []vscode.Version{{Version: "1.0.0"}},
+	}
+	// metadata with statistics is saved as is, without querying Marketplace
+	if err := db.SaveExtensionMetadata(e); err != nil {
+		t.Fatal(err)
+	}
+	b, err := afero.ReadFile(db.fs, ExtensionMetaFile(db.root, e))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := vscode.Extension{}
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.InstallCount() != 10 {
+		t.Errorf("expected install count 10 but got %v", saved.InstallCount())
+	}
+	if len(saved.Versions) != 0 {
+		t.Errorf("expected versions to be left out of the extension metadata but got %v", len(saved.Versions))
+	}
+}
+
+// countingWriteFs counts the files opened for writing.
+type countingWriteFs struct {
+	afero.Fs
+	writes *int
+}
+
+func (f countingWriteFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		*f.writes++
+	}
+	return f.Fs.OpenFile(name, flag, perm)
+}
+
+func TestSaveUnchangedExtensionMetadata(t *testing.T) {
+	writes := 0
+	db, err := open(countingWriteFs{Fs: afero.NewMemMapFs(), writes: &writes}, "/data", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := vscode.Extension{
+		Name:       "go",
+		Publisher:  vscode.Publisher{Name: "golang"},
+		Statistics: []vscode.Statistic{{Name: string(vscode.StatisticInstall), Value: 10}},
+	}
+	if err := db.SaveExtensionMetadata(e); err != nil {
+		t.Fatal(err)
+	}
+	writes = 0
+	if err := db.SaveExtensionMetadata(e); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 0 {
+		t.Errorf("expected unchanged metadata not to be written, got %v writes", writes)
+	}
+	e.Statistics[0].Value = 11
+	if err := db.SaveExtensionMetadata(e); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 1 {
+		t.Errorf("expected changed metadata to be written once, got %v writes", writes)
+	}
+}
+
+// failingRenameFs fails all renames.
+type failingRenameFs struct {
+	afero.Fs
+}
+
+func (f failingRenameFs) Rename(oldname, newname string) error {
+	return fmt.Errorf("could not rename %s", oldname)
+}
+
+func TestWriteFile(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	filename := "/data/golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage"
+	if err := afero.WriteFile(mem, filename, []byte("intact"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tempFiles := func() []string {
+		matches, err := afero.Glob(mem, path.Join(path.Dir(filename), tempFilePrefix+"*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return matches
+	}
+
+	db, err := open(failingRenameFs{Fs: mem}, "/data", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.writeFile(filename, strings.NewReader("new")); err == nil {
+		t.Fatal("expected write to fail")
+	}
+	if b, _ := afero.ReadFile(mem, filename); string(b) != "intact" {
+		t.Errorf("expected existing file to be left as is after failed write, got %s", b)
+	}
+	if files := tempFiles(); len(files) > 0 {
+		t.Errorf("expected temporary file to be removed, found %v", files)
+	}
+
+	db, err = open(mem, "/data", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.writeFile(filename, strings.NewReader("new")); err != nil || n != 3 {
+		t.Fatalf("expected 3 bytes to be written, got %v: %v", n, err)
+	}
+	if b, _ := afero.ReadFile(mem, filename); string(b) != "new" {
+		t.Errorf("expected file to contain new, got %s", b)
+	}
+	if files := tempFiles(); len(files) > 0 {
+		t.Errorf("expected no temporary files, found %v", files)
+	}
+}
+
+func TestRunWithFilter(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exts := []vscode.Extension{}
+	for i := 0; i < 10; i++ {
+		exts = append(exts, vscode.Extension{ID: fmt.Sprint(i)})
+	}
+	db.setItems(exts)
+	q := marketplace.NewQuery()
+	q.Filters[0].PageSize = 3
+	even := func(e vscode.Extension) bool {
+		return slices.Contains([]string{"0", "2", "4", "6", "8"}, e.ID)
+	}
+	res, err := db.RunWithFilter(q, even)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results[0].Extensions) != 3 {
+		t.Errorf("expected a full page of 3 extensions but got %v", len(res.Results[0].Extensions))
+	}
+	for _, e := range res.Results[0].Extensions {
+		if !even(e) {
+			t.Errorf("expected extension %s to be filtered out", e.ID)
+		}
+	}
+	if count := res.Results[0].ResultMetadata[0].MetadataItems[0].Count; count != 5 {
+		t.Errorf("expected total count to only include kept extensions, got %v", count)
+	}
+}
+
+// crossDeviceFs fails to rename files in dir, like renaming across file systems.
+type crossDeviceFs struct {
+	afero.Fs
+	dir string
+}
+
+func (f crossDeviceFs) Rename(oldname, newname string) error {
+	if strings.HasPrefix(oldname, f.dir+"/") {
+		return fmt.Errorf("could not rename %s: invalid cross-device link", oldname)
+	}
+	return f.Fs.Rename(oldname, newname)
+}
+
+func TestWriteFileTempDir(t *testing.T) {
+	defer func() { TempDir = "" }()
+	TempDir = "/scratch"
+	filename := "/data/golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage"
+	for _, crossDevice := range []bool{false, true} {
+		mem := afero.NewMemMapFs()
+		if err := mem.MkdirAll(TempDir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := mem.MkdirAll(path.Dir(filename), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		var fs afero.Fs = mem
+		if crossDevice {
+			fs = crossDeviceFs{Fs: mem, dir: TempDir}
+		}
+		db, err := open(fs, "/data", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.writeFile(filename, strings.NewReader("content")); err != nil {
+			t.Fatalf("cross device %v: %v", crossDevice, err)
+		}
+		if b, _ := afero.ReadFile(mem, filename); string(b) != "content" {
+			t.Errorf("cross device %v: expected file to contain content, got %s", crossDevice, b)
+		}
+		for _, dir := range []string{TempDir, path.Dir(filename)} {
+			if matches, _ := afero.Glob(mem, path.Join(dir, tempFilePrefix+"*")); len(matches) > 0 {
+				t.Errorf("cross device %v: expected no temporary files, found %v", crossDevice, matches)
+			}
+		}
+	}
+}
+
+func TestLoadProgress(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	for _, name := range []string{"go", "java", "python"} {
+		e := vscode.Extension{Name: name, Publisher: vscode.Publisher{Name: "test"}}
+		if err := afero.WriteFile(mem, ExtensionMetaFile("/data", e), []byte(e.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defaultInterval := loadProgressInterval
+	loadProgressInterval = 0
+	defer func() { loadProgressInterval = defaultInterval }()
+
+	db, err := new("/data", mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	db.dblog = zerolog.New(buf)
+	if err := db.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"0 of 3 extensions loaded", "2 of 3 extensions loaded"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected progress %q to be logged, got %s", expected, buf.String())
+		}
+	}
+
+	// with LoadProgress set progress is written there, regardless of log level, instead
+	buf.Reset()
+	progress := &bytes.Buffer{}
+	LoadProgress = progress
+	defer func() { LoadProgress = nil }()
+	db.dblog = zerolog.New(buf).Level(zerolog.ErrorLevel)
+	if err := db.load(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(progress.String(), "2 of 3 extensions loaded") {
+		t.Errorf("expected progress to be written to LoadProgress, got %q", progress.String())
+	}
+	if buf.Len() > 0 {
+		t.Errorf("expected progress not to be logged, got %s", buf.String())
+	}
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/afero"
+)
+
+// marketplaceETag is the content of the ETag file. The ETag is only valid for the same
+// pre-release setting since the latest version depends on it.
+type marketplaceETag struct {
+	ETag       string `json:"etag"`
+	PreRelease bool   `json:"pre_release"`
+}
+
+// MarketplaceETag returns the ETag received from Marketplace when the extension was last
+// found to be up to date. An empty string is returned if there is no ETag or if it was saved
+// with a different pre-release setting.
+func (db *DB) MarketplaceETag(e vscode.Extension, preRelease bool) string {
+	b, err := afero.ReadFile(db.fs, ETagFile(db.root, e))
+	if err != nil {
+		return ""
+	}
+	etag := marketplaceETag{}
+	if err := json.Unmarshal(b, &etag); err != nil || etag.PreRelease != preRelease {
+		return ""
+	}
+	return etag.ETag
+}
+
+// SaveMarketplaceETag saves the ETag received from Marketplace for the extension.
+func (db *DB) SaveMarketplaceETag(e vscode.Extension, etag string, preRelease bool) error {
+	b, err := json.Marshal(marketplaceETag{ETag: etag, PreRelease: preRelease})
+	if err != nil {
+		return err
+	}
+	return afero.WriteFile(db.fs, ETagFile(db.root, e), b, os.ModePerm)
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestMarketplaceETag(t *testing.T) {
+	db, err := OpenMem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := vscode.Extension{Name: "go", Publisher: vscode.Publisher{Name: "golang"}}
+	if etag := db.MarketplaceETag(e, false); etag != "" {
+		t.Errorf("expected no ETag but got %s", etag)
+	}
+	if err := db.SaveMarketplaceETag(e, `"v1"`, false); err != nil {
+		t.Fatal(err)
+	}
+	if etag := db.MarketplaceETag(e, false); etag != `"v1"` {
+		t.Errorf("expected ETag \"v1\" but got %s", etag)
+	}
+	if etag := db.MarketplaceETag(e, true); etag != "" {
+		t.Errorf("expected no ETag for pre-release but got %s", etag)
+	}
+}
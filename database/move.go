@@ -0,0 +1,67 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/afero"
+)
+
+// MoveExtension moves extension e, with all of its versions and assets, to the given publisher
+// and name, for example when a publisher has been renamed at Marketplace. The publisher name and
+// extension name in the extension metadata are updated, the rest of the metadata is kept as is.
+// Moving fails if an extension with the new publisher and name already exists, ignoring case
+// like lookups by unique identifier do. Reload the database to find the extension under its new
+// unique identifier.
+func (db *DB) MoveExtension(e vscode.Extension, publisher, name string) error {
+	moved := e
+	moved.Publisher.Name = publisher
+	moved.Name = name
+	db.dblog.Info().Str("extension", e.UniqueID()).Str("destination", moved.UniqueID()).Msg("moving extension")
+
+	// only changing the case of the extension's own unique identifier is not a conflict
+	if existing, found := db.GetByUniqueID(false, moved.UniqueID()); found && !strings.EqualFold(existing.UniqueID(), e.UniqueID()) {
+		return fmt.Errorf("%s already exists as %s", moved.UniqueID(), existing.UniqueID())
+	}
+	src, dst := ExtensionDir(db.root, e), ExtensionDir(db.root, moved)
+	if _, err := db.fs.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", moved.UniqueID())
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	b, err := afero.ReadFile(db.fs, ExtensionMetaFile(db.root, e))
+	if err != nil {
+		return err
+	}
+	meta := vscode.Extension{}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return fmt.Errorf("could not parse extension metadata: %w", err)
+	}
+	meta.Publisher.Name = publisher
+	meta.Name = name
+
+	if err := db.fs.MkdirAll(path.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	if err := db.fs.Rename(src, dst); err != nil {
+		return err
+	}
+	if err := afero.WriteFile(db.fs, ExtensionMetaFile(db.root, moved), []byte(meta.String()), os.ModePerm); err != nil {
+		// move the extension back to keep directory and metadata in line
+		if rbErr := db.fs.Rename(dst, src); rbErr != nil {
+			db.dblog.Err(rbErr).Str("path", dst).Msg("could not move extension back after failing to update metadata")
+		}
+		return err
+	}
+	// remove the directory of the old publisher if this was its last extension
+	if entries, err := afero.ReadDir(db.fs, path.Dir(src)); err == nil && len(entries) == 0 {
+		if err := db.fs.Remove(path.Dir(src)); err != nil {
+			db.dblog.Err(err).Str("path", path.Dir(src)).Msg("could not remove empty publisher directory")
+		}
+	}
+	return nil
+}
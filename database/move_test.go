@@ -0,0 +1,60 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestMoveExtension(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"oldpub/go/" + extensionMetadataFileName:                          `{"extensionId":"abc-123","extensionName":"go","publisher":{"publisherName":"oldpub","displayName":"Old"}}`,
+		"oldpub/go/1.0.0/abc/" + versionMetadataFileName:                  `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"oldpub/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage": "hello",
+		"taken/go/" + extensionMetadataFileName:                           `{"extensionName":"go","publisher":{"publisherName":"taken"}}`,
+	}
+	writeFixture(t, afero.NewOsFs(), root, files)
+	db, err := OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, found := db.GetByUniqueID(false, "oldpub.go")
+	if !found {
+		t.Fatal("extension not found")
+	}
+
+	if err := db.MoveExtension(ext, "taken", "go"); err == nil {
+		t.Fatal("expected error when moving to an existing extension")
+	}
+	if err := db.MoveExtension(ext, "Taken", "Go"); err == nil {
+		t.Fatal("expected error when moving to an existing extension with another case")
+	}
+	if err := db.MoveExtension(ext, "newpub", "golang"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := db.GetByUniqueID(false, "oldpub.go"); found {
+		t.Error("expected extension to be gone from its old unique identifier")
+	}
+	moved, found := db.GetByUniqueID(false, "newpub.golang")
+	if !found {
+		t.Fatal("expected extension to be found by its new unique identifier")
+	}
+	if moved.ID != "abc-123" || moved.Publisher.DisplayName != "Old" {
+		t.Errorf("expected remaining metadata to be kept, got %v", moved)
+	}
+	if len(moved.Versions) != 1 || len(moved.Versions[0].Files) != 1 {
+		t.Fatalf("expected version and asset to be moved, got %v", moved.Versions)
+	}
+	if b, err := os.ReadFile(moved.Versions[0].Files[0].Path); err != nil || string(b) != "hello" {
+		t.Errorf("expected asset to be intact, got %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "oldpub")); !os.IsNotExist(err) {
+		t.Errorf("expected empty publisher directory to be removed, got %v", err)
+	}
+}
@@ -34,15 +34,9 @@ func process(fsys fs.FS, dir string, processor DirEntryProcessor) (PruneResult,
 	files, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			if dir == "." {
-				fmt.Printf("prune: could not find directory %s\n", fsys)
-			} else {
-				fmt.Printf("prune: could not find directory %s/%s\n", fsys, dir)
-			}
-		} else {
-			fmt.Printf("prune.process: %s\n", err)
+			return result, fmt.Errorf("prune: could not find directory %s: %w", dir, err)
 		}
-		os.Exit(1)
+		return result, fmt.Errorf("prune: could not read directory %s: %w", dir, err)
 	}
 	for _, file := range files {
 		fullPath := path.Join(dir, file.Name())
@@ -108,7 +102,8 @@ func publisherProcessor(fsys fs.FS, fullPath string, entry fs.DirEntry) (PruneRe
 	return result, nil
 }
 
-// extensionProcessor the prune logic used for files in the extension folder. Remove everything but the extension metadata file and non empty subfolders.
+// extensionProcessor the prune logic used for files in the extension folder. Remove everything but the extension metadata file,
+// the last accessed file, the ETag file and non empty subfolders.
 func extensionProcessor(fsys fs.FS, fullPath string, entry fs.DirEntry) (PruneResult, error) {
 	result := NewPruneResult()
 	if entry.IsDir() {
@@ -124,7 +119,7 @@ func extensionProcessor(fsys fs.FS, fullPath string, entry fs.DirEntry) (PruneRe
 			result.Kept = append(result.Kept, fullPath)
 		}
 	} else {
-		if entry.Name() == extensionMetadataFileName {
+		if entry.Name() == extensionMetadataFileName || entry.Name() == lastAccessedFileName || entry.Name() == etagFileName {
 			result.Kept = append(result.Kept, fullPath)
 		} else {
 			result.Removed = append(result.Removed, fullPath)
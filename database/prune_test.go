@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"io/fs"
 	"slices"
 	"strings"
@@ -131,3 +132,10 @@ func TestClean(t *testing.T) {
 	}
 
 }
+
+func TestProcessMissingDir(t *testing.T) {
+	_, err := process(fstest.MapFS{}, "missing", rootProcessor)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+}
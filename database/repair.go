@@ -0,0 +1,72 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/afero"
+)
+
+// DamagedAssets returns the assets listed in the stored metadata of version v whose files are
+// missing from the local storage or, if manifest is not nil, do not match their checksum in
+// manifest. The manifest is keyed by the path relative to the root of the local storage, as
+// in Checksum. Returned assets have Path set to where the file belongs and Source set to where
+// it can be downloaded from. If the metadata has no source for an asset the source is built
+// from the asset URI of the version.
+func (db *DB) DamagedAssets(e vscode.Extension, v vscode.Version, manifest map[string]Checksum) ([]vscode.Asset, error) {
+	b, err := afero.ReadFile(db.fs, VersionMetaFile(db.root, e, v))
+	if err != nil {
+		return nil, err
+	}
+	stored := vscode.Version{}
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, fmt.Errorf("could not parse version metadata: %w", err)
+	}
+	damaged := []vscode.Asset{}
+	for _, a := range stored.Files {
+		a.Path = AssetFile(db.root, e, v, a)
+		if a.Source == "" && stored.AssetURI != "" {
+			a.Source = strings.TrimSuffix(stored.AssetURI, "/") + "/" + string(a.Type)
+		}
+		if _, err := db.fs.Stat(a.Path); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+			damaged = append(damaged, a)
+			continue
+		}
+		if manifest == nil {
+			continue
+		}
+		rel, err := filepath.Rel(db.root, a.Path)
+		if err != nil {
+			return nil, err
+		}
+		expected, found := manifest[filepath.ToSlash(rel)]
+		if !found {
+			continue
+		}
+		sum, err := db.checksum(a.Path)
+		if err != nil {
+			return nil, err
+		}
+		if sum.Size != expected.Size || sum.SHA256 != expected.SHA256 {
+			damaged = append(damaged, a)
+		}
+	}
+	return damaged, nil
+}
+
+// RepairAssetFile replaces the file of asset a, as returned by DamagedAssets, with the content
+// read from r. Unlike SaveAssetFile the version is not rolled back if writing fails, leaving
+// intact assets of the version in place.
+func (db *DB) RepairAssetFile(a vscode.Asset, r io.Reader) error {
+	db.dblog.Debug().Str("source", a.Source).Str("destination", a.Path).Msg("repairing asset file")
+	_, err := db.writeFile(a.Path, r)
+	return err
+}
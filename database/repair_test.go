@@ -0,0 +1,103 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/afero"
+)
+
+func TestDamagedAssets(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"golang/go/" + extensionMetadataFileName: `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"golang/go/1.0.0/abc/" + versionMetadataFileName: `{"version":"1.0.0","assetUri":"https://x/abc","files":[
+			{"assetType":"Microsoft.VisualStudio.Services.VSIXPackage","source":"https://x/abc/vsix"},
+			{"assetType":"Microsoft.VisualStudio.Code.Manifest","source":"https://x/abc/manifest"},
+			{"assetType":"Microsoft.VisualStudio.Services.Icons.Default"},
+			{"assetType":"Microsoft.VisualStudio.Services.Content.Changelog","source":"https://x/abc/changelog"}]}`,
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage":       "hello",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Code.Manifest":              "{}",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Content.Changelog": "changes",
+	}
+	writeFixture(t, afero.NewOsFs(), root, files)
+	db, err := OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, found := db.GetByUniqueID(false, "golang.go")
+	if !found {
+		t.Fatal("extension not found")
+	}
+	v := ext.Versions[0]
+
+	// without a manifest only missing files are damaged
+	damaged, err := db.DamagedAssets(ext, v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(damaged) != 1 || damaged[0].Type != vscode.IconsDefault {
+		t.Fatalf("expected only the icon to be damaged, got %v", damaged)
+	}
+	if damaged[0].Source != "https://x/abc/Microsoft.VisualStudio.Services.Icons.Default" {
+		t.Errorf("expected source to be built from asset URI, got %s", damaged[0].Source)
+	}
+
+	manifest := map[string]Checksum{
+		// tampered
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage": {Size: 5, SHA256: "0000"},
+		// intact
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Code.Manifest": {Size: 2, SHA256: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},
+	}
+	damaged, err = db.DamagedAssets(ext, v, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := []vscode.AssetTypeKey{}
+	for _, a := range damaged {
+		types = append(types, a.Type)
+	}
+	if len(types) != 2 || types[0] != vscode.VSIXPackage || types[1] != vscode.IconsDefault {
+		t.Fatalf("expected VSIX package and icon to be damaged, got %v", types)
+	}
+
+	if err := db.RepairAssetFile(damaged[0], strings.NewReader("fixed")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(root, "golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.VSIXPackage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "fixed" {
+		t.Errorf("expected repaired file to contain fixed, got %s", b)
+	}
+	if _, err := os.Stat(filepath.Join(root, "golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Content.Changelog")); err != nil {
+		t.Errorf("intact asset should be left in place: %v", err)
+	}
+}
+
+func TestTemporaryFilesAreNotAssets(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"golang/go/" + extensionMetadataFileName:                          `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"golang/go/1.0.0/abc/" + versionMetadataFileName:                  `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"golang/go/1.0.0/abc/" + tempFilePrefix + "VSIXPackage-123":       "partial",
+		"golang/go/1.0.0/abc/Microsoft.VisualStudio.Services.Icons.Small": "icon",
+	}
+	writeFixture(t, afero.NewOsFs(), root, files)
+	db, err := OpenFs(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, found := db.GetByUniqueID(false, "golang.go")
+	if !found {
+		t.Fatal("extension not found")
+	}
+	assets := ext.Versions[0].Files
+	if len(assets) != 1 || assets[0].Type != vscode.IconsSmall {
+		t.Errorf("expected only the icon as asset, got %v", assets)
+	}
+}
@@ -9,6 +9,8 @@ import (
 const (
 	extensionMetadataFileName string = "_vsix_db_extension_metadata.json"
 	versionMetadataFileName   string = "_vsix_db_version_metadata.json"
+	lastAccessedFileName      string = "_vsix_db_last_accessed"
+	etagFileName              string = "_vsix_db_marketplace_etag"
 )
 
 // ExtensionDir return the path to the extension in the database store where
@@ -30,6 +32,16 @@ func ExtensionMetaFile(root string, e vscode.Extension) string {
 	return path.Join(ExtensionDir(root, e), extensionMetadataFileName)
 }
 
+// LastAccessedFile return the path to the file recording when the extension was last served.
+func LastAccessedFile(root string, e vscode.Extension) string {
+	return path.Join(ExtensionDir(root, e), lastAccessedFileName)
+}
+
+// ETagFile return the path to the file holding the Marketplace ETag of the extension.
+func ETagFile(root string, e vscode.Extension) string {
+	return path.Join(ExtensionDir(root, e), etagFileName)
+}
+
 // VersionMetaFile returns the file path to the metadata file for a given version.
 func VersionMetaFile(root string, e vscode.Extension, v vscode.Version) string {
 	return path.Join(VersionDir(root, e, v), versionMetadataFileName)
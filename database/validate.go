@@ -0,0 +1,21 @@
+package database
+
+import "fmt"
+
+// ValidationError describes a problem with a file or directory in the local storage found
+// while loading the database. Extensions and versions with problems are not loaded.
+type ValidationError struct {
+	Path   string
+	Reason string
+}
+
+func (ve ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", ve.Path, ve.Reason)
+}
+
+// ValidationErrors returns the problems found when the database was last loaded.
+func (db *DB) ValidationErrors() []ValidationError {
+	db.itemsMux.RLock()
+	defer db.itemsMux.RUnlock()
+	return append([]ValidationError{}, db.invalid...)
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spagettikod/vsix/vscode"
+	"github.com/spf13/afero"
+)
+
+func TestValidationErrors(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	files := map[string]string{
+		// valid extension with one valid and one misplaced version
+		"/data/golang/go/" + extensionMetadataFileName:                    `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"/data/golang/go/1.0.0/abc/" + versionMetadataFileName:            `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"/data/golang/go/2.0.0/abc/" + versionMetadataFileName:            `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"/data/golang/go/3.0.0/abc/" + versionMetadataFileName:            `not json`,
+		"/data/golang/tools/" + extensionMetadataFileName:                 `{"extensionName":"tools","publisher":{"publisherName":"someone"}}`,
+		"/data/someone/tools/1.0.0/abc/" + versionMetadataFileName + ".x": ``,
+	}
+	writeFixture(t, mem, "/", files)
+	db, err := open(mem, "/data", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{
+		"/data/golang/go/2.0.0/abc": true,
+		"/data/golang/go/3.0.0/abc": true,
+		"/data/golang/tools":        true,
+		"/data/someone/tools":       true,
+	}
+	invalid := db.ValidationErrors()
+	for _, ve := range invalid {
+		if !expected[ve.Path] {
+			t.Errorf("unexpected validation error %v", ve)
+		}
+	}
+	if len(invalid) != len(expected) {
+		t.Errorf("expected %v validation errors but got %v: %v", len(expected), len(invalid), invalid)
+	}
+
+	ext, found := db.GetByUniqueID(false, "golang.go")
+	if !found {
+		t.Fatal("expected golang.go to be loaded")
+	}
+	if len(ext.Versions) != 1 {
+		t.Errorf("expected 1 valid version but got %v", len(ext.Versions))
+	}
+	if _, found := db.GetByUniqueID(false, vscode.Extension{Name: "tools", Publisher: vscode.Publisher{Name: "someone"}}.UniqueID()); found {
+		t.Error("did not expect the misplaced extension someone.tools to be loaded")
+	}
+}
+
+func TestMisplacedAreNotLoaded(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	writeFixture(t, mem, "/data", map[string]string{
+		"golang/tools/" + extensionMetadataFileName:         `{"extensionName":"tools","publisher":{"publisherName":"someone"}}`,
+		"golang/tools/1.0.0/abc/" + versionMetadataFileName: `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"golang/go/" + extensionMetadataFileName:            `{"extensionName":"go","publisher":{"publisherName":"golang"}}`,
+		"golang/go/1.0.0/abc/" + versionMetadataFileName:    `{"version":"1.0.0","assetUri":"https://x/abc"}`,
+		"golang/go/1.0.0/def/" + versionMetadataFileName:    `{"version":"2.0.0","assetUri":"https://x/def"}`,
+	})
+	db, err := open(mem, "/data", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exts := db.List(false); len(exts) != 1 || exts[0].UniqueID() != "golang.go" || len(exts[0].Versions) != 1 {
+		t.Fatalf("expected only golang.go 1.0.0 to be loaded, got %v", exts)
+	}
+	if invalid := db.ValidationErrors(); len(invalid) != 2 {
+		t.Errorf("expected the misplaced extension and version to be reported, got %v", invalid)
+	}
+
+	// moved to where they belong they are loaded again
+	if err := mem.Rename("/data/golang/tools", "/data/someone/tools"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.MkdirAll("/data/golang/go/2.0.0", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Rename("/data/golang/go/1.0.0/def", "/data/golang/go/2.0.0/def"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if exts := db.List(false); len(exts) != 2 {
+		t.Errorf("expected both extensions to be loaded, got %v", exts)
+	}
+	if ext, _ := db.GetByUniqueID(false, "golang.go"); len(ext.Versions) != 2 {
+		t.Errorf("expected both versions of golang.go to be loaded, got %v", ext.Versions)
+	}
+	if invalid := db.ValidationErrors(); len(invalid) != 0 {
+		t.Errorf("expected no validation errors, got %v", invalid)
+	}
+}
@@ -0,0 +1,214 @@
+package marketplace
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spagettikod/vsix/vscode"
+)
+
+var (
+	// UserAgent is sent in the User-Agent header of all requests to Marketplace.
+	UserAgent = "vsix"
+	// Token, if set, is sent as a bearer token in the Authorization header of gallery
+	// requests, see galleryHeaders. Used with private galleries that require authentication.
+	Token = ""
+	// Locale, if set, is sent in the Accept-Language header of queries to Marketplace to get
+	// display names and descriptions in that language, where available. For example sv-SE.
+	Locale = ""
+	// baseTransport is the transport of Client, a copy of the default transport so its TLS
+	// configuration can be changed without affecting other clients.
+	baseTransport = http.DefaultTransport.(*http.Transport).Clone()
+	// Client is the HTTP client used for all requests to Marketplace.
+	Client = &http.Client{Transport: &transport{base: baseTransport}}
+)
+
+// SetGalleryURL sends queries, and latest version lookups, to the gallery at galleryURL instead
+// of the public Marketplace. The gallery URL is the serviceUrl of a gallery in product.json,
+// for example https://gallery.example.com/_apis/public/gallery. Queries are sent to
+// <gallery URL>/extensionquery and latest versions are looked up at
+// <gallery URL>/<publisher>/<name>/latest.
+func SetGalleryURL(galleryURL string) error {
+	u, err := url.Parse(galleryURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s is not an http or https URL", galleryURL)
+	}
+	galleryURL = strings.TrimSuffix(galleryURL, "/")
+	queryURL = galleryURL + "/extensionquery"
+	latestVersionURL = galleryURL + "/%s/%s/latest"
+	privateGallery = true
+	return nil
+}
+
+// AddCACertFile makes Client trust the PEM encoded CA certificates in the file at path, in
+// addition to the system certificates. Used when requests go through a TLS-intercepting proxy
+// or to a private gallery with certificates issued by an internal CA.
+func AddCACertFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return fmt.Errorf("no PEM encoded certificates found in %s", path)
+	}
+	tlsConfig().RootCAs = pool
+	return nil
+}
+
+// SkipVerify turns off verification of server certificates in Client when skip is true. This
+// makes connections insecure and should only be used for testing, for example against a
+// mirror with a self-signed certificate.
+func SkipVerify(skip bool) {
+	tlsConfig().InsecureSkipVerify = skip
+}
+
+// tlsConfig returns the TLS configuration of Client.
+func tlsConfig() *tls.Config {
+	if baseTransport.TLSClientConfig == nil {
+		baseTransport.TLSClientConfig = &tls.Config{}
+	}
+	return baseTransport.TLSClientConfig
+}
+
+// transport adds headers common to all requests to Marketplace.
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", UserAgent)
+	return t.base.RoundTrip(req)
+}
+
+// galleryHeaders adds the headers of gallery API requests to req, the Authorization header if
+// a token is set and the Accept-Language header if a locale is set. It is used for queries
+// and, when a gallery is set with SetGalleryURL, for latest version lookups. Latest versions
+// at the public Marketplace are looked up at www.vscode-unpkg.net and assets can be served from
+// other hosts, these should not get the token.
+func galleryHeaders(req *http.Request) {
+	if Token != "" {
+		req.Header.Set("Authorization", "Bearer "+Token)
+	}
+	if Locale != "" {
+		req.Header.Set("Accept-Language", Locale)
+	}
+}
+
+// OpenAsset requests the asset from its source at Marketplace and returns the response body
+// to read the asset content from. The caller must close it. If the download is interrupted
+// it is resumed from where it stopped, see resumingBody.
+func OpenAsset(a vscode.Asset) (io.ReadCloser, error) {
+	resp, err := Client.Get(a.Source)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("asset download returned HTTP %v", resp.StatusCode)
+	}
+	validator := resp.Header.Get("ETag")
+	if validator == "" {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	return &resumingBody{source: a.Source, validator: validator, body: resp.Body, size: resp.ContentLength}, nil
+}
+
+// AssetSize returns the size in bytes of an asset opened with OpenAsset, as reported by
+// Marketplace before any content is read. The size is -1 if it is unknown.
+func AssetSize(r io.Reader) int64 {
+	if body, ok := r.(*resumingBody); ok {
+		return body.size
+	}
+	return -1
+}
+
+// maxResumes is how many times an interrupted asset download is resumed
+const maxResumes = 3
+
+// resumingBody reads the body of an asset download. If reading fails before the whole body
+// has been read the download is resumed with an HTTP Range request from the first byte not
+// yet read. If the server does not support ranges, or the asset has changed, the read error
+// is returned as is.
+type resumingBody struct {
+	source string
+	// validator is the ETag, or Last-Modified, of the first response, sent in If-Range so
+	// a changed asset is never resumed
+	validator string
+	body      io.ReadCloser
+	// size is the Content-Length of the first response, -1 if unknown
+	size    int64
+	offset  int64
+	resumes int
+}
+
+func (r *resumingBody) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == nil || err == io.EOF || r.resumes >= maxResumes {
+		return n, err
+	}
+	r.resumes++
+	lg := log.With().Str("component", "marketplace").Str("source", r.source).Int64("offset", r.offset).Int("attempt", r.resumes).Logger()
+	lg.Warn().Err(err).Msg("asset download interrupted, resuming")
+	if resumeErr := r.resume(); resumeErr != nil {
+		lg.Debug().Err(resumeErr).Msg("could not resume asset download")
+		return n, err
+	}
+	return n, nil
+}
+
+// resume requests the rest of the asset, from offset, replacing the body.
+func (r *resumingBody) resume() error {
+	req, err := http.NewRequest(http.MethodGet, r.source, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	if r.validator != "" {
+		req.Header.Set("If-Range", r.validator)
+	}
+	resp, err := Client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return fmt.Errorf("resumed asset download returned HTTP %v", resp.StatusCode)
+	}
+	if contentRange := resp.Header.Get("Content-Range"); !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", r.offset)) {
+		resp.Body.Close()
+		return fmt.Errorf("resumed asset download returned unexpected range %s", contentRange)
+	}
+	r.body.Close()
+	r.body = resp.Body
+	return nil
+}
+
+func (r *resumingBody) Close() error {
+	return r.body.Close()
+}
+
+// DownloadAsset fetches the asset from its source at Marketplace.
+func DownloadAsset(a vscode.Asset) ([]byte, error) {
+	body, err := OpenAsset(a)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
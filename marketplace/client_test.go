@@ -0,0 +1,309 @@
+package marketplace
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spagettikod/vsix/vscode"
+)
+
+func TestUserAgent(t *testing.T) {
+	expected := "vsix/test"
+	actual := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual = r.Header.Get("User-Agent")
+		w.Write([]byte("asset"))
+	}))
+	defer srv.Close()
+
+	defaultUserAgent := UserAgent
+	UserAgent = expected
+	defer func() { UserAgent = defaultUserAgent }()
+
+	b, err := DownloadAsset(vscode.Asset{Source: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "asset" {
+		t.Errorf("expected body %s but got %s", "asset", string(b))
+	}
+	if actual != expected {
+		t.Errorf("expected User-Agent %s but got %s", expected, actual)
+	}
+}
+
+// headerStub starts a server answering both gallery queries and latest version requests. It
+// records the value of the named header of each request and the queryURL and latestVersionURL
+// are pointed to the server until the test ends.
+func headerStub(t *testing.T, name string) *[]string {
+	values := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values = append(values, r.Header.Get(name))
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"results":[{"extensions":[{"versions":[{"version":"1.0.0"}]}]}]}`))
+			return
+		}
+		w.Write([]byte(`{"versions":[{"version":"1.0.0"}]}`))
+	}))
+	defaultQueryURL, defaultLatestVersionURL := queryURL, latestVersionURL
+	queryURL, latestVersionURL = srv.URL+"/query", srv.URL+"/%s/%s/latest"
+	t.Cleanup(func() {
+		queryURL, latestVersionURL = defaultQueryURL, defaultLatestVersionURL
+		srv.Close()
+	})
+	return &values
+}
+
+func TestToken(t *testing.T) {
+	auth := headerStub(t, "Authorization")
+
+	if _, err := QueryLatestVersionByUniqueID("golang.go").Run(); err != nil {
+		t.Fatal(err)
+	}
+	Token = "secret"
+	defer func() { Token = "" }()
+	if _, err := QueryLatestVersionByUniqueID("golang.go").Run(); err != nil {
+		t.Fatal(err)
+	}
+	// latest version is looked up at www.vscode-unpkg.net which is not sent the token
+	if _, err := LatestVersion("golang.go", false); err != nil {
+		t.Fatal(err)
+	}
+	// assets are not sent the token
+	if _, err := DownloadAsset(vscode.Asset{Source: queryURL}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"", "Bearer secret", "", ""}
+	if !slices.Equal(*auth, expected) {
+		t.Errorf("expected Authorization headers %q but got %q", expected, *auth)
+	}
+}
+
+func TestGalleryURL(t *testing.T) {
+	requests := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"results":[{"extensions":[{"versions":[{"version":"1.0.0"}]}]}]}`))
+			return
+		}
+		w.Write([]byte(`{"versions":[{"version":"1.0.0"}]}`))
+	}))
+	defer srv.Close()
+	defaultQueryURL, defaultLatestVersionURL := queryURL, latestVersionURL
+	defer func() {
+		queryURL, latestVersionURL, privateGallery = defaultQueryURL, defaultLatestVersionURL, false
+	}()
+
+	for _, invalid := range []string{"", "gallery.example.com", "ftp://gallery.example.com"} {
+		if err := SetGalleryURL(invalid); err == nil {
+			t.Errorf("expected %q to be an invalid gallery URL", invalid)
+		}
+	}
+	if err := SetGalleryURL(srv.URL + "/_apis/public/gallery/"); err != nil {
+		t.Fatal(err)
+	}
+	Token = "secret"
+	defer func() { Token = "" }()
+	if _, err := QueryLatestVersionByUniqueID("golang.go").Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LatestVersion("golang.go", false); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"POST /_apis/public/gallery/extensionquery Bearer secret",
+		"GET /_apis/public/gallery/golang/go/latest Bearer secret",
+	}
+	if !slices.Equal(requests, expected) {
+		t.Errorf("expected requests %q but got %q", expected, requests)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	languages := headerStub(t, "Accept-Language")
+
+	if _, err := QueryLatestVersionByUniqueID("golang.go").Run(); err != nil {
+		t.Fatal(err)
+	}
+	Locale = "sv-SE"
+	defer func() { Locale = "" }()
+	if _, err := QueryLatestVersionByUniqueID("golang.go").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"", "sv-SE"}
+	if !slices.Equal(*languages, expected) {
+		t.Errorf("expected Accept-Language headers %q but got %q", expected, *languages)
+	}
+}
+
+func TestLatestVersionIfModified(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"versions":[{"version":"1.0.0"}]}`))
+	}))
+	defer srv.Close()
+
+	defaultURL := latestVersionURL
+	latestVersionURL = srv.URL + "/%s/%s/latest"
+	defer func() { latestVersionURL = defaultURL }()
+
+	version, etag, err := LatestVersionIfModified("golang.go", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "1.0.0" || etag != `"v1"` {
+		t.Errorf("expected version 1.0.0 and ETag \"v1\" but got %s and %s", version, etag)
+	}
+	if _, _, err := LatestVersionIfModified("golang.go", false, etag); !errors.Is(err, ErrNotModified) {
+		t.Errorf("expected ErrNotModified but got %v", err)
+	}
+}
+
+func TestLatestVersionUnpublished(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/golang/") {
+			w.Write([]byte(`{"flags":"validated, public, unpublished","versions":[{"version":"1.0.0"}]}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	defaultURL := latestVersionURL
+	latestVersionURL = srv.URL + "/%s/%s/latest"
+	defer func() { latestVersionURL = defaultURL }()
+
+	if _, err := LatestVersion("golang.go", false); !errors.Is(err, ErrExtensionUnpublished) {
+		t.Errorf("expected ErrExtensionUnpublished but got %v", err)
+	}
+	if _, err := LatestVersion("foo.bar", false); !errors.Is(err, ErrExtensionNotFound) {
+		t.Errorf("expected ErrExtensionNotFound but got %v", err)
+	}
+}
+
+func TestAddCACertFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("asset"))
+	}))
+	defer srv.Close()
+	defer func() { baseTransport.TLSClientConfig = nil }()
+
+	if _, err := DownloadAsset(vscode.Asset{Source: srv.URL}); err == nil {
+		t.Fatal("expected certificate of test server to not be trusted")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddCACertFile(caFile); err != nil {
+		t.Fatal(err)
+	}
+	b, err := DownloadAsset(vscode.Asset{Source: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "asset" {
+		t.Errorf("expected body %s but got %s", "asset", string(b))
+	}
+
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddCACertFile(caFile); err == nil {
+		t.Error("expected error when file has no certificates")
+	}
+}
+
+func TestSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("asset"))
+	}))
+	defer srv.Close()
+	defer func() { baseTransport.TLSClientConfig = nil }()
+
+	SkipVerify(true)
+	if _, err := DownloadAsset(vscode.Asset{Source: srv.URL}); err != nil {
+		t.Fatalf("expected self-signed certificate to be accepted: %v", err)
+	}
+	SkipVerify(false)
+	// close idle connections, otherwise the verified connection is reused
+	baseTransport.CloseIdleConnections()
+	if _, err := DownloadAsset(vscode.Asset{Source: srv.URL}); err == nil {
+		t.Error("expected self-signed certificate to be rejected")
+	}
+}
+
+func TestOpenAssetResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	ranges := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Range") == "" {
+			// send 80% of the asset, then drop the connection
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write(content[:len(content)*8/10])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	body, err := OpenAsset(vscode.Asset{Source: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, content) {
+		t.Errorf("expected %v bytes of content but got %v bytes", len(content), len(b))
+	}
+	if len(ranges) != 1 || ranges[0] != fmt.Sprintf("bytes=%d-", len(content)*8/10) {
+		t.Errorf("expected download to be resumed from 80%%, got ranges %v", ranges)
+	}
+}
+
+func TestOpenAssetNoRangeSupport(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Write(content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer srv.Close()
+
+	body, err := OpenAsset(vscode.Asset{Source: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if _, err := io.ReadAll(body); err == nil {
+		t.Error("expected interrupted download to fail when the server does not support ranges")
+	}
+}
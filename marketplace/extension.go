@@ -19,14 +19,23 @@ type ExtensionRequest struct {
 	UniqueID        string
 	Version         string
 	TargetPlatforms []string
+	AssetTypes      []vscode.AssetTypeKey
 	PreRelease      bool
 	Force           bool
+	// MaxAssetSize is the size, in bytes, of the largest asset to download. Larger assets are
+	// skipped, except for the VSIX package. Zero means no limit.
+	MaxAssetSize int64
 }
 
 var (
 	ErrVersionNotFound           error = errors.New("could not find version at Marketplace")
 	ErrMultiplatformNotSupported error = errors.New("multi-platform extensions are not supported yet")
 	ErrOutDirNotFound            error = errors.New("output dir does not exist")
+	ErrNotModified               error = errors.New("extension has not been modified at Marketplace")
+	ErrExtensionUnpublished      error = errors.New("extension has been unpublished from Marketplace")
+	// latestVersionURL is the endpoint used by LatestVersion, publisher and name are inserted,
+	// see SetGalleryURL
+	latestVersionURL = "https://www.vscode-unpkg.net/_gallery/%s/%s/latest"
 )
 
 func Deduplicate(ers []ExtensionRequest) []ExtensionRequest {
@@ -39,27 +48,54 @@ func Deduplicate(ers []ExtensionRequest) []ExtensionRequest {
 }
 
 func LatestVersion(uniqueID string, preRelease bool) (string, error) {
+	version, _, err := LatestVersionIfModified(uniqueID, preRelease, "")
+	return version, err
+}
+
+// LatestVersionIfModified works like LatestVersion but sends etag, if given, in the If-None-Match
+// header. ErrNotModified is returned if the extension has not changed since etag was received.
+// The ETag of the response is returned together with the latest version.
+func LatestVersionIfModified(uniqueID string, preRelease bool, etag string) (string, string, error) {
 	ext := vscode.Extension{}
 	s := strings.Split(uniqueID, ".")
 	if len(s) != 2 {
-		return "", fmt.Errorf("invalid unique ID %s", uniqueID)
+		return "", "", fmt.Errorf("invalid unique ID %s", uniqueID)
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(latestVersionURL, s[0], s[1]), nil)
+	if err != nil {
+		return "", "", err
 	}
-	resp, err := http.Get(fmt.Sprintf("https://www.vscode-unpkg.net/_gallery/%s/%s/latest", s[0], s[1]))
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if privateGallery {
+		galleryHeaders(req)
+	}
+	resp, err := Client.Do(req)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return "", etag, ErrNotModified
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", "", ErrExtensionNotFound
 	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("check for latest extension version returned HTTP %v", resp.StatusCode)
+		return "", "", fmt.Errorf("check for latest extension version returned HTTP %v", resp.StatusCode)
 	}
 	bites, err := io.ReadAll(resp.Body)
-	defer resp.Body.Close()
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	if err := json.Unmarshal(bites, &ext); err != nil {
-		return "", err
+		return "", "", err
 	}
-	return ext.LatestVersion(preRelease), nil
+	if ext.IsUnpublished() {
+		return "", "", ErrExtensionUnpublished
+	}
+	return ext.LatestVersion(preRelease), resp.Header.Get("ETag"), nil
 }
 
 func FetchExtension(uniqueID string) (vscode.Extension, error) {
@@ -67,6 +103,9 @@ func FetchExtension(uniqueID string) (vscode.Extension, error) {
 	if err != nil {
 		return vscode.Extension{}, err
 	}
+	if eqr.Results[0].Extensions[0].IsUnpublished() {
+		return vscode.Extension{}, ErrExtensionUnpublished
+	}
 	uuid := eqr.Results[0].Extensions[0].ID
 	eqr, err = QueryAllVersionsByUniqueID(uuid).Run()
 	if err != nil {
@@ -115,6 +154,16 @@ func (pe ExtensionRequest) ValidTargetPlatform(v vscode.Version) bool {
 	return false
 }
 
+// ValidAssetType returns true if the given asset matches the asset types
+// that were requested in the ExtensionRequest.
+func (pe ExtensionRequest) ValidAssetType(a vscode.Asset) bool {
+	// no asset types were given, all assets are valid
+	if len(pe.AssetTypes) == 0 {
+		return true
+	}
+	return slices.Contains(pe.AssetTypes, a.Type)
+}
+
 func (pe ExtensionRequest) String() string {
 	if pe.Version == "" {
 		return pe.UniqueID
@@ -125,7 +174,7 @@ func (pe ExtensionRequest) String() string {
 // rewrite this, half the code is the same as Download, recursive function complicates things,
 // maybe rethink the entire setup?
 func (pe ExtensionRequest) DownloadVSIXPackage(root string, preRelease bool) error {
-	elog := log.With().Str("extension", pe.UniqueID).Str("dir", root).Logger()
+	elog := log.With().Str("component", "marketplace").Str("extension", pe.UniqueID).Str("dir", root).Logger()
 
 	elog.Debug().Msg("only VSIXPackage will be fetched")
 	elog.Debug().Msg("checking if output directory exists")
@@ -183,7 +232,7 @@ func (pe ExtensionRequest) DownloadVSIXPackage(root string, preRelease bool) err
 		Str("source", asset.Source).
 		Msg("downloading")
 	// download setting filename to asset type
-	b, err := asset.Download()
+	b, err := DownloadAsset(asset)
 	if err != nil {
 		return err
 	}
@@ -193,7 +242,7 @@ func (pe ExtensionRequest) DownloadVSIXPackage(root string, preRelease bool) err
 // Download fetches metadata for the requested extension and returns it
 // as an Extension struct.
 func (extReq ExtensionRequest) Download(preRelease bool) (vscode.Extension, error) {
-	elog := log.With().Str("extension", extReq.UniqueID).Str("extension_version", extReq.Version).Logger()
+	elog := log.With().Str("component", "marketplace").Str("extension", extReq.UniqueID).Str("extension_version", extReq.Version).Logger()
 
 	elog.Debug().Msg("searching for extension at Marketplace")
 	ext, err := FetchExtension(extReq.UniqueID)
@@ -2,6 +2,8 @@ package marketplace
 
 import (
 	"testing"
+
+	"github.com/spagettikod/vsix/vscode"
 )
 
 func TestEquals(t *testing.T) {
@@ -64,3 +66,17 @@ func TestDeduplicate(t *testing.T) {
 		t.Errorf("result %v, doesn't match expected results", result)
 	}
 }
+
+func TestValidAssetType(t *testing.T) {
+	er := ExtensionRequest{UniqueID: "golang.Go"}
+	if !er.ValidAssetType(vscode.Asset{Type: vscode.IconsDefault}) {
+		t.Error("expected all asset types to be valid when no asset types are requested")
+	}
+	er.AssetTypes = []vscode.AssetTypeKey{vscode.VSIXPackage, vscode.Manifest}
+	if !er.ValidAssetType(vscode.Asset{Type: vscode.VSIXPackage}) {
+		t.Errorf("expected %v to be valid", vscode.VSIXPackage)
+	}
+	if er.ValidAssetType(vscode.Asset{Type: vscode.IconsDefault}) {
+		t.Errorf("expected %v to not be valid", vscode.IconsDefault)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/rs/zerolog/log"
 	"github.com/spagettikod/vsix/vscode"
 )
 
@@ -36,7 +38,7 @@ type Filter struct {
 	PageNumber int          `json:"pageNumber"`
 	PageSize   int          `json:"pageSize"`
 	SortBy     SortCriteria `json:"sortBy"`
-	SortOrder  int          `json:"sortOrder"`
+	SortOrder  SortOrder    `json:"sortOrder"`
 }
 
 func (f Filter) GetCriteria(filterType FilterType) (Criteria, bool) {
@@ -54,6 +56,7 @@ type Criteria struct {
 }
 
 type SortCriteria int
+type SortOrder int
 type FilterType int
 
 const (
@@ -63,6 +66,11 @@ const (
 	ByPublishedDate SortCriteria = 10
 	ByRating        SortCriteria = 12
 
+	// SortDefault sorts in the default order of the sort criteria, descending for all but ByName
+	SortDefault    SortOrder = 0
+	SortAscending  SortOrder = 1
+	SortDescending SortOrder = 2
+
 	FlagIncludeVersions            QueryFlag = 0x1
 	FlagIncludeFiles               QueryFlag = 0x2
 	FlagIncludeCatergoryAndTags    QueryFlag = 0x4
@@ -84,10 +92,21 @@ const (
 	FilterTypeSearchText    FilterType = 10
 
 	MaximumPageSize = 1000
+	// pageAttempts is the number of times a page is requested before RunAll gives up
+	pageAttempts = 3
 
 	debugEnvVar = "VSIX_DEBUG"
 )
 
+var (
+	// queryURL is the Marketplace endpoint queries are sent to, see SetGalleryURL
+	queryURL = "https://marketplace.visualstudio.com/_apis/public/gallery/extensionquery"
+	// privateGallery is true when queries are sent to a gallery set with SetGalleryURL
+	privateGallery = false
+	// pageRetryDelay is the time RunAll waits before requesting a failed page again
+	pageRetryDelay = 2 * time.Second
+)
+
 var (
 	MSVSCodeCriteria          = Criteria{FilterType: FilterTypeTarget, Value: "Microsoft.VisualStudio.Code"}
 	SomeUnknownCriteria       = Criteria{FilterType: 12, Value: "4096"}
@@ -98,7 +117,8 @@ var (
 
 type extensionQueryResponse struct {
 	Results []struct {
-		Extensions []vscode.Extension `json:"extensions"`
+		Extensions     []vscode.Extension      `json:"extensions"`
+		ResultMetadata []vscode.ResultMetadata `json:"resultMetadata"`
 	} `json:"results"`
 }
 
@@ -118,7 +138,7 @@ func NewQuery() Query {
 		PageNumber: 1,
 		PageSize:   1,
 		SortBy:     ByNone,
-		SortOrder:  0,
+		SortOrder:  SortDefault,
 	}
 	q.Filters = append(q.Filters, f)
 	q.Flags = FlagIncludeLatestVersionOnly | FlagExcludeNonValidated | FlagIncludeAssetURI | FlagIncludeVersionProperties | FlagIncludeFiles | FlagIncludeCatergoryAndTags
@@ -174,9 +194,26 @@ func (q Query) IsValid() bool {
 	return false
 }
 
-// RunAll executes the Run function until all pages with extensions are fetched.
+// RunAll executes the Run function until all pages with extensions are fetched. Pages are
+// fetched one at a time and extensions are returned in the order Marketplace returned them.
 func (q Query) RunAll(limit int) ([]vscode.Extension, error) {
-	if limit == 0 || limit >= MaximumPageSize {
+	return q.RunAllFiltered(limit, nil)
+}
+
+// RunAllFiltered executes the Run function until all pages with extensions are fetched. Only
+// extensions where keep returns true are included in the result and counted towards the limit.
+// A nil keep function keeps all extensions.
+func (q Query) RunAllFiltered(limit int, keep func(vscode.Extension) bool) ([]vscode.Extension, error) {
+	exts, _, err := q.RunAllCounted(limit, keep)
+	return exts, err
+}
+
+// RunAllCounted runs the query like RunAllFiltered and also returns the total number of
+// extensions matching the query at Marketplace, before extensions are filtered by keep. The
+// total is -1 if Marketplace did not return it.
+func (q Query) RunAllCounted(limit int, keep func(vscode.Extension) bool) ([]vscode.Extension, int, error) {
+	total := -1
+	if limit == 0 || limit >= MaximumPageSize || keep != nil {
 		q.Filters[0].PageSize = MaximumPageSize
 	} else {
 		q.Filters[0].PageSize = limit
@@ -184,11 +221,23 @@ func (q Query) RunAll(limit int) ([]vscode.Extension, error) {
 
 	exts := []vscode.Extension{}
 	for {
-		eqr, err := q.Run()
+		eqr, err := q.runPage()
 		if err != nil {
-			return exts, err
+			// an empty page after the first one means we've fetched all extensions
+			if errors.Is(err, ErrExtensionNotFound) && q.Filters[0].PageNumber > 1 {
+				break
+			}
+			// return what we've got so far together with the error
+			return exts, total, fmt.Errorf("could not fetch page %v, returning the %v extensions fetched before the error: %w", q.Filters[0].PageNumber, len(exts), err)
+		}
+		if count, found := vscode.TotalCount(eqr.Results[0].ResultMetadata); found && total == -1 {
+			total = count
+		}
+		for _, ext := range eqr.Results[0].Extensions {
+			if keep == nil || keep(ext) {
+				exts = append(exts, ext)
+			}
 		}
-		exts = append(exts, eqr.Results[0].Extensions...)
 		// if there is a limit set (limit is larger than 0) exit when we've got the requested number of extensions or more
 		if (limit > 0 && len(exts) >= limit) || len(eqr.Results[0].Extensions) < q.Filters[0].PageSize {
 			break
@@ -197,30 +246,67 @@ func (q Query) RunAll(limit int) ([]vscode.Extension, error) {
 	}
 	// if there is no limit (limit is zero), we return all extensions found, otherwise slice the correct number of extensions
 	if limit == 0 || len(exts) < limit {
-		return exts, nil
+		return exts, total, nil
 	} else {
-		return exts[:limit], nil
+		return exts[:limit], total, nil
 	}
 }
 
+// statusError is returned by Run when the gallery responds with another status than 200 OK.
+type statusError struct {
+	host       string
+	statusCode int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("%s returned HTTP %v", e.host, e.statusCode)
+}
+
+// transient returns true if the request might succeed if sent again, for 429 Too Many Requests
+// and server errors. Other client errors, like an invalid query or token, fail the same way again.
+func (e statusError) transient() bool {
+	return e.statusCode == http.StatusTooManyRequests || e.statusCode >= 500
+}
+
+// runPage runs the query, retrying up to pageAttempts times if the request fails because of a
+// network error, or a transient HTTP status, see statusError. Queries returning no extensions
+// are not retried.
+func (q Query) runPage() (eqr extensionQueryResponse, err error) {
+	for attempt := 1; attempt <= pageAttempts; attempt++ {
+		eqr, err = q.Run()
+		if err == nil || errors.Is(err, ErrExtensionNotFound) || errors.Is(err, ErrExtensionHasNoVersions) {
+			return
+		}
+		if se := (statusError{}); errors.As(err, &se) && !se.transient() {
+			return
+		}
+		log.Debug().Str("component", "marketplace").Err(err).Int("page", q.Filters[0].PageNumber).Int("attempt", attempt).Msg("query failed")
+		if attempt < pageAttempts {
+			time.Sleep(pageRetryDelay)
+		}
+	}
+	return
+}
+
 func (q Query) Run() (extensionQueryResponse, error) {
 	if _, debug := os.LookupEnv(debugEnvVar); debug {
 		os.WriteFile("query.json", []byte(q.ToJSON()), 0644)
 	}
 	eqr := extensionQueryResponse{}
-	req, err := http.NewRequest(http.MethodPost, "https://marketplace.visualstudio.com/_apis/public/gallery/extensionquery", strings.NewReader(q.ToJSON()))
+	req, err := http.NewRequest(http.MethodPost, queryURL, strings.NewReader(q.ToJSON()))
 	if err != nil {
 		return eqr, err
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json;api-version=3.0-preview.1")
-	c := http.Client{}
-	resp, err := c.Do(req)
+	galleryHeaders(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		return eqr, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return eqr, fmt.Errorf("marketplace.visualstudio.com returned HTTP %v", resp.StatusCode)
+		return eqr, statusError{host: req.URL.Host, statusCode: resp.StatusCode}
 	}
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -233,7 +319,7 @@ func (q Query) Run() (extensionQueryResponse, error) {
 	if err != nil {
 		return eqr, err
 	}
-	if len(eqr.Results[0].Extensions) == 0 {
+	if len(eqr.Results) == 0 || len(eqr.Results[0].Extensions) == 0 {
 		return eqr, ErrExtensionNotFound
 	}
 	if len(eqr.Results[0].Extensions[0].Versions) == 0 {
@@ -251,6 +337,10 @@ func (q Query) SortBy() SortCriteria {
 	return q.Filters[0].SortBy
 }
 
+func (q Query) SortOrder() SortOrder {
+	return q.Filters[0].SortOrder
+}
+
 func QueryNoCritera(sortBy SortCriteria) Query {
 	q := NewQuery()
 	q.Filters[0].Criteria = []Criteria{}
@@ -274,6 +364,14 @@ func QueryLastestVersionByText(query string, sortBy SortCriteria) Query {
 	return q
 }
 
+// QueryFeatured returns a query for the extensions featured at Marketplace. Sort by ByNone to get
+// them in the order they are featured.
+func QueryFeatured(sortBy SortCriteria) Query {
+	q := QueryNoCritera(sortBy)
+	q.AddCriteria(Criteria{FilterType: FilterTypeFeatured})
+	return q
+}
+
 func QueryLatestVersionByUniqueID(uniqueID string) Query {
 	q := NewQuery()
 	q.AddCriteria(Criteria{
@@ -290,6 +388,6 @@ func QueryAllVersionsByUniqueID(uniqueID string) Query {
 		FilterType: FilterTypeExtensionID,
 		Value:      uniqueID,
 	})
-	q.Flags = FlagIncludeVersions | FlagIncludeFiles | FlagIncludeVersionProperties | FlagExcludeNonValidated | FlagIncludeStatistics
+	q.Flags = FlagIncludeVersions | FlagIncludeFiles | FlagIncludeVersionProperties | FlagExcludeNonValidated | FlagIncludeCatergoryAndTags | FlagIncludeStatistics
 	return q
 }
@@ -1,8 +1,13 @@
 package marketplace
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/spagettikod/vsix/vscode"
 )
 
 func TestAddCritera(t *testing.T) {
@@ -37,6 +42,19 @@ func TestAddCritera(t *testing.T) {
 	}
 }
 
+func TestQueryFeatured(t *testing.T) {
+	q := QueryFeatured(ByNone)
+	if values := q.CriteriaValues(FilterTypeFeatured); len(values) != 1 {
+		t.Errorf("expected one featured criteria, got %v", values)
+	}
+	if !q.IsValid() || q.IsEmptyQuery() {
+		t.Error("expected a valid, non empty, query")
+	}
+	if q.SortBy() != ByNone {
+		t.Errorf("expected sort by none, got %v", q.SortBy())
+	}
+}
+
 func TestIsEmptyQuery(t *testing.T) {
 	q := NewQuery()
 	if !q.IsEmptyQuery() {
@@ -73,3 +91,125 @@ func TestFlag(t *testing.T) {
 	fmt.Printf("%v - FlagIncludeVersions: %v\n", f, f.Is(FlagIncludeVersions))
 	fmt.Printf("%v - FlagUnpublished: %v\n", f, f.Is(FlagUnpublished))
 }
+
+// marketplaceStub returns a server responding to queries with pageCount full pages of extensions. Requests for pages in failingPages fail with HTTP 500 the given number of times.
+func marketplaceStub(t *testing.T, pageCount int, failingPages map[int]int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := Query{}
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			// the handler runs in the server goroutine where t.Fatal can not be used
+			t.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		page := q.Filters[0].PageNumber
+		if failingPages[page] > 0 {
+			failingPages[page]--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		eqr := extensionQueryResponse{Results: []struct {
+			Extensions     []vscode.Extension      `json:"extensions"`
+			ResultMetadata []vscode.ResultMetadata `json:"resultMetadata"`
+		}{{Extensions: []vscode.Extension{}, ResultMetadata: vscode.NewResults().Results[0].ResultMetadata}}}
+		eqr.Results[0].ResultMetadata[0].MetadataItems[0].Count = pageCount * q.Filters[0].PageSize
+		for i := 0; page <= pageCount && i < q.Filters[0].PageSize; i++ {
+			eqr.Results[0].Extensions = append(eqr.Results[0].Extensions, vscode.Extension{
+				Name:     fmt.Sprintf("%v-%v", page, i),
+				Versions: []vscode.Version{{Version: "1.0.0"}},
+			})
+		}
+		json.NewEncoder(w).Encode(eqr)
+	}))
+	defaultURL, defaultDelay := queryURL, pageRetryDelay
+	queryURL, pageRetryDelay = srv.URL, 0
+	t.Cleanup(func() {
+		queryURL, pageRetryDelay = defaultURL, defaultDelay
+		srv.Close()
+	})
+	return srv
+}
+
+func TestRunAllRetry(t *testing.T) {
+	marketplaceStub(t, 3, map[int]int{2: pageAttempts - 1})
+	q := NewQuery()
+	exts, err := q.RunAll(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exts) != 3*MaximumPageSize {
+		t.Errorf("expected %v extensions but got %v", 3*MaximumPageSize, len(exts))
+	}
+}
+
+func TestRunPageRetryStatus(t *testing.T) {
+	tests := map[int]int{
+		http.StatusBadRequest:          1,
+		http.StatusUnauthorized:        1,
+		http.StatusForbidden:           1,
+		http.StatusNotFound:            1,
+		http.StatusTooManyRequests:     pageAttempts,
+		http.StatusInternalServerError: pageAttempts,
+		http.StatusBadGateway:          pageAttempts,
+	}
+	for status, expected := range tests {
+		requests := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(status)
+		}))
+		defaultURL, defaultDelay := queryURL, pageRetryDelay
+		queryURL, pageRetryDelay = srv.URL, 0
+		if _, err := NewQuery().runPage(); err == nil {
+			t.Errorf("HTTP %v: expected an error", status)
+		}
+		queryURL, pageRetryDelay = defaultURL, defaultDelay
+		srv.Close()
+		if requests != expected {
+			t.Errorf("HTTP %v: expected %v requests but got %v", status, expected, requests)
+		}
+	}
+}
+
+func TestRunAllPartial(t *testing.T) {
+	marketplaceStub(t, 10, map[int]int{7: pageAttempts})
+	q := NewQuery()
+	exts, err := q.RunAll(0)
+	if err == nil {
+		t.Fatal("expected error when a page fails")
+	}
+	if len(exts) != 6*MaximumPageSize {
+		t.Errorf("expected the %v extensions fetched before the error but got %v", 6*MaximumPageSize, len(exts))
+	}
+}
+
+func TestRunAllOrder(t *testing.T) {
+	marketplaceStub(t, 3, map[int]int{})
+	q := NewQuery()
+	exts, err := q.RunAll(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ext := range exts {
+		expected := fmt.Sprintf("%v-%v", i/MaximumPageSize+1, i%MaximumPageSize)
+		if ext.Name != expected {
+			t.Fatalf("expected extension %s at position %v but got %s", expected, i, ext.Name)
+		}
+	}
+}
+
+func TestRunAllCounted(t *testing.T) {
+	marketplaceStub(t, 3, map[int]int{})
+	q := NewQuery()
+	exts, total, err := q.RunAllCounted(10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exts) != 10 {
+		t.Errorf("expected 10 extensions but got %v", len(exts))
+	}
+	// the limit fits on one page, the stub reports the total for pages of that size
+	if total != 3*10 {
+		t.Errorf("expected total %v but got %v", 3*10, total)
+	}
+}
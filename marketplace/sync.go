@@ -3,6 +3,7 @@ package marketplace
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -58,7 +59,7 @@ func parseFile(p string) ([]ExtensionRequest, error) {
 		plog.Debug().Msg("parsing file")
 		exts, err = parse(data)
 		if err != nil {
-			return exts, err
+			return exts, fmt.Errorf("could not parse %s: %w", p, err)
 		}
 		plog.Info().Msgf("found %v extentions in file", len(exts))
 	} else {
@@ -68,31 +69,140 @@ func parseFile(p string) ([]ExtensionRequest, error) {
 	return exts, nil
 }
 
-// parse will process file data and extract all valid extension requests from the file
-func parse(data []byte) (extensions []ExtensionRequest, err error) {
-	buf := bytes.NewBuffer(data)
-	scanner := bufio.NewScanner(buf)
+// ListError describes an invalid line in an extension list file.
+type ListError struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (le ListError) Error() string {
+	return fmt.Sprintf("line %v: %s: %s", le.Line, le.Reason, le.Text)
+}
+
+// ListEntry is a valid extension request found at Line in an extension list file. Group is the
+// name of the group the entry is listed under, empty if it is listed before the first group.
+type ListEntry struct {
+	Line    int
+	Group   string
+	Request ExtensionRequest
+}
+
+// ValidateList checks each line of an extension list file. It returns the valid entries and
+// a ListError for each malformed line. Comments and empty lines are ignored. A line with a
+// name in brackets, like [go-dev], starts a group and the following entries belong to it.
+func ValidateList(data []byte) ([]ListEntry, []ListError, error) {
+	entries := []ListEntry{}
+	listErrors := []ListError{}
+	scanner := bufio.NewScanner(bytes.NewBuffer(data))
+	lineNo := 0
+	group := ""
 	for scanner.Scan() {
+		lineNo++
 		line := strings.TrimSpace(scanner.Text())
 		if strings.Index(line, "#") == 0 || len(line) == 0 {
 			continue
 		}
-		splitLine := strings.Split(line, " ")
-		ext := ExtensionRequest{}
-		if len(splitLine) > 0 && len(splitLine) < 3 {
-			ext.UniqueID = strings.TrimSpace(splitLine[0])
-			if len(splitLine) == 2 {
-				ext.Version = strings.TrimSpace(splitLine[1])
-			}
-			extensions = append(extensions, ext)
-			if ext.Version == "" {
-				log.Debug().Str("extension", ext.UniqueID).Msg("parsed")
-			} else {
-				log.Debug().Str("extension", ext.UniqueID).Str("version", ext.Version).Msg("parsed")
+		if name, found := parseGroup(line); found {
+			if name == "" {
+				listErrors = append(listErrors, ListError{Line: lineNo, Text: line, Reason: "group name can not be empty"})
 			}
+			group = name
+			continue
+		}
+		ext, reason := parseLine(line)
+		if reason != "" {
+			listErrors = append(listErrors, ListError{Line: lineNo, Text: line, Reason: reason})
+			continue
+		}
+		entries = append(entries, ListEntry{Line: lineNo, Group: group, Request: ext})
+	}
+	return entries, listErrors, scanner.Err()
+}
+
+// ReadCollection reads the extension list file at p and returns the requests listed under the
+// named group, ignoring case. All requests in the file are returned if group is empty. An error
+// is returned if the file has invalid lines or if the group has no requests.
+func ReadCollection(p, group string) ([]ExtensionRequest, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	entries, listErrors, err := ValidateList(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := joinListErrors(listErrors); err != nil {
+		return nil, fmt.Errorf("invalid lines in %s: %w", p, err)
+	}
+	ers := []ExtensionRequest{}
+	for _, entry := range entries {
+		if group == "" || strings.EqualFold(entry.Group, group) {
+			ers = append(ers, entry.Request)
 		}
 	}
-	return extensions, scanner.Err()
+	if group != "" && len(ers) == 0 {
+		return nil, fmt.Errorf("group %s was not found in %s, or it has no extensions", group, p)
+	}
+	return ers, nil
+}
+
+// parseGroup returns the name of the group started by line, a name in brackets, and true. False
+// is returned if the line does not start a group.
+func parseGroup(line string) (string, bool) {
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+	return strings.TrimSpace(line[1 : len(line)-1]), true
+}
+
+// parseLine parses a single, non empty, line in an extension list file. If the line is
+// not valid the reason is returned.
+func parseLine(line string) (ExtensionRequest, string) {
+	ext := ExtensionRequest{}
+	splitLine := strings.Fields(line)
+	if len(splitLine) > 2 {
+		return ext, "expected a unique identifier optionally followed by a version"
+	}
+	ext.UniqueID = splitLine[0]
+	if publisher, name, found := strings.Cut(ext.UniqueID, "."); !found || publisher == "" || name == "" || strings.Contains(name, ".") {
+		return ext, "unique identifier should be publisher.name"
+	}
+	if len(splitLine) == 2 {
+		ext.Version = splitLine[1]
+	}
+	return ext, ""
+}
+
+// parse returns the extension requests in the data of an extension list file. The lines are
+// checked with ValidateList and an error is returned if any line is invalid.
+func parse(data []byte) ([]ExtensionRequest, error) {
+	entries, listErrors, err := ValidateList(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := joinListErrors(listErrors); err != nil {
+		return nil, err
+	}
+	extensions := []ExtensionRequest{}
+	for _, entry := range entries {
+		extensions = append(extensions, entry.Request)
+		if entry.Request.Version == "" {
+			log.Debug().Str("extension", entry.Request.UniqueID).Msg("parsed")
+		} else {
+			log.Debug().Str("extension", entry.Request.UniqueID).Str("version", entry.Request.Version).Msg("parsed")
+		}
+	}
+	return extensions, nil
+}
+
+// joinListErrors returns the list errors joined into one error, nil is returned if there are none.
+func joinListErrors(listErrors []ListError) error {
+	errs := []error{}
+	for _, le := range listErrors {
+		errs = append(errs, le)
+	}
+	return errors.Join(errs...)
 }
 
 // isPlainText will try to auto detect if the given data is a text file.
@@ -0,0 +1,111 @@
+package marketplace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateList(t *testing.T) {
+	data := []byte(`# curated extensions
+golang.Go
+redhat.java 1.2.0
+
+golang.Go 0.31.1 extra
+golangGo
+`)
+	entries, listErrors, err := ValidateList(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 valid entries but got %v", len(entries))
+	}
+	if entries[1].Line != 3 || entries[1].Request.UniqueID != "redhat.java" || entries[1].Request.Version != "1.2.0" {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+	if len(listErrors) != 2 {
+		t.Fatalf("expected 2 invalid lines but got %v", len(listErrors))
+	}
+	if listErrors[0].Line != 5 {
+		t.Errorf("expected malformed line at line 5 but got %v", listErrors[0].Line)
+	}
+	if listErrors[1].Line != 6 {
+		t.Errorf("expected invalid identifier at line 6 but got %v", listErrors[1].Line)
+	}
+}
+
+func TestValidateListGroups(t *testing.T) {
+	data := []byte(`golang.Go
+[go-dev]
+golang.Go 0.31.1
+[ ]
+redhat.java
+`)
+	entries, listErrors, err := ValidateList(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 valid entries but got %v", len(entries))
+	}
+	if entries[0].Group != "" || entries[1].Group != "go-dev" {
+		t.Errorf("unexpected groups %q and %q", entries[0].Group, entries[1].Group)
+	}
+	if len(listErrors) != 1 || listErrors[0].Line != 4 {
+		t.Errorf("expected empty group name at line 4 to be invalid, got %v", listErrors)
+	}
+}
+
+func TestParse(t *testing.T) {
+	ers, err := parse([]byte(`# curated extensions
+[go-dev]
+golang.Go 0.31.1
+
+redhat.java
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ers) != 2 || ers[0].UniqueID != "golang.Go" || ers[0].Version != "0.31.1" || ers[1].UniqueID != "redhat.java" {
+		t.Errorf("unexpected requests %+v", ers)
+	}
+	// lines rejected by ValidateList are rejected when parsing
+	if _, err := parse([]byte("golang.Go\ngolangGo\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected the invalid line 2 to be reported, got %v", err)
+	}
+}
+
+func TestReadCollection(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "collection.txt")
+	data := `# curated collections
+[Go-Dev]
+golang.Go
+ms-vscode.makefile-tools 0.10.0
+[python-dev]
+ms-python.python
+`
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ers, err := ReadCollection(p, "go-dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ers) != 2 || ers[0].UniqueID != "golang.Go" || ers[1].Version != "0.10.0" {
+		t.Errorf("expected the go-dev group, got %+v", ers)
+	}
+	if ers, err := ReadCollection(p, ""); err != nil || len(ers) != 3 {
+		t.Errorf("expected all 3 extensions without group, got %v: %v", len(ers), err)
+	}
+	if _, err := ReadCollection(p, "rust-dev"); err == nil {
+		t.Error("expected error for unknown group")
+	}
+	if err := os.WriteFile(p, []byte("[go-dev]\ngolangGo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCollection(p, "go-dev"); err == nil {
+		t.Error("expected error for invalid collection")
+	}
+}
@@ -3,9 +3,9 @@ package vscode
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"os"
+	"slices"
+	"strings"
 )
 
 type AssetTypeKey string
@@ -53,6 +53,59 @@ func StrToAssetType(assetType string) (AssetTypeKey, error) {
 	}
 }
 
+// assetTypeNames maps short names, used on the command line, to asset types.
+var assetTypeNames = map[string]AssetTypeKey{
+	"manifest":     Manifest,
+	"changelog":    ContentChangelog,
+	"details":      ContentDetails,
+	"license":      ContentLicense,
+	"icon":         IconsDefault,
+	"icon-small":   IconsSmall,
+	"vsixmanifest": VSIXManifest,
+	"vsix":         VSIXPackage,
+	"signature":    VSIXSignature,
+}
+
+// AssetTypeNames returns the short names accepted by ParseAssetTypes.
+func AssetTypeNames() []string {
+	names := []string{}
+	for name := range assetTypeNames {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// AssetTypeName returns the short name of the asset type, for example vsix. The
+// full asset type is returned if it has no short name.
+func AssetTypeName(t AssetTypeKey) string {
+	for name, at := range assetTypeNames {
+		if at == t {
+			return name
+		}
+	}
+	return string(t)
+}
+
+// ParseAssetTypes converts a list of asset type names to asset types. Names
+// can either be the short name, for example vsix or manifest, or the full
+// asset type, for example Microsoft.VisualStudio.Services.VSIXPackage.
+func ParseAssetTypes(names []string) ([]AssetTypeKey, error) {
+	types := []AssetTypeKey{}
+	for _, name := range names {
+		if t, found := assetTypeNames[strings.ToLower(name)]; found {
+			types = append(types, t)
+			continue
+		}
+		t, err := StrToAssetType(name)
+		if err != nil {
+			return types, err
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
 func NewAsset(assetType AssetTypeKey, source string) Asset {
 	return Asset{Type: assetType, Source: source}
 }
@@ -61,14 +114,6 @@ func (a Asset) Is(t AssetTypeKey) bool {
 	return a.Type == t
 }
 
-func (a Asset) Download() ([]byte, error) {
-	resp, err := http.Get(a.Source)
-	if err != nil {
-		return []byte{}, err
-	}
-	return ioutil.ReadAll(resp.Body)
-}
-
 // Validate return true if the asset is valid. It checks if
 // the file exist and that it's not a directory.
 func (a Asset) Validate() (bool, error) {
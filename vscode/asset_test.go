@@ -22,3 +22,32 @@ func Test_Abs(t *testing.T) {
 	// 	}
 	// }
 }
+
+func TestParseAssetTypes(t *testing.T) {
+	types, err := ParseAssetTypes([]string{"vsix", "Manifest", string(IconsDefault)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []AssetTypeKey{VSIXPackage, Manifest, IconsDefault}
+	if len(types) != len(expected) {
+		t.Fatalf("expected %v asset types but got %v", len(expected), len(types))
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("expected %v but got %v", expected[i], types[i])
+		}
+	}
+
+	if _, err := ParseAssetTypes([]string{"vsix", "nope"}); err == nil {
+		t.Error("expected error for unknown asset type")
+	}
+}
+
+func TestAssetTypeName(t *testing.T) {
+	if got := AssetTypeName(VSIXPackage); got != "vsix" {
+		t.Errorf("expected vsix, got %v", got)
+	}
+	if got := AssetTypeName(AssetTypeKey("Unknown.Type")); got != "Unknown.Type" {
+		t.Errorf("expected Unknown.Type, got %v", got)
+	}
+}
@@ -1,6 +1,8 @@
 package vscode
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"slices"
@@ -97,6 +99,38 @@ func (e Extension) Copy() Extension {
 	return e2
 }
 
+// hasFlag returns true if flag is in flags, a comma separated list like "validated, public".
+func hasFlag(flags, flag string) bool {
+	for _, f := range strings.Split(flags, ",") {
+		if strings.EqualFold(strings.TrimSpace(f), flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag returns true if the extension is tagged with tag, case is ignored.
+func (e Extension) HasTag(tag string) bool {
+	return slices.ContainsFunc(e.Tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
+
+// IsUnpublished returns true if the extension has been unpublished from Marketplace by its publisher.
+func (e Extension) IsUnpublished() bool {
+	return hasFlag(e.Flags, "unpublished")
+}
+
+// IsPreview returns true if the extension is marked as preview at Marketplace.
+func (e Extension) IsPreview() bool {
+	return hasFlag(e.Flags, "preview")
+}
+
+// IsVerified returns true if the publisher is verified at Marketplace.
+func (p Publisher) IsVerified() bool {
+	return hasFlag(p.Flags, "verified")
+}
+
 func (e Extension) IsExtensionPack() bool {
 	return len(e.ExtensionPack()) > 0
 }
@@ -181,6 +215,18 @@ func (e Extension) String() string {
 	return string(b)
 }
 
+// Hash returns a SHA-256 checksum of the extension metadata, including versions and assets.
+// Fields not stored in the metadata, like Path, are ignored. Use it to tell if the metadata
+// of an extension has changed.
+func (e Extension) Hash() string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
 // LatestVersion returns the latest version number for the extension with the given unique ID.
 func (e Extension) LatestVersion(preRelease bool) string {
 	if len(e.Versions) == 0 {
@@ -197,6 +243,25 @@ func (e Extension) LatestVersion(preRelease bool) string {
 	return ""
 }
 
+// VersionsForPlatform returns the versions for the given target platform, in the same order
+// as they appear in Versions.
+func (e Extension) VersionsForPlatform(platform string) []Version {
+	versions := []Version{}
+	for _, v := range e.Versions {
+		if v.TargetPlatform() == platform {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// LatestVersionForPlatform returns the latest version available for the given target platform.
+// Like LatestVersion, pre-release versions are only considered if preRelease is true. An empty
+// string is returned if there is no version for the platform.
+func (e Extension) LatestVersionForPlatform(platform string, preRelease bool) string {
+	return Extension{Versions: e.VersionsForPlatform(platform)}.LatestVersion(preRelease)
+}
+
 func (e Extension) Version(version string) ([]Version, bool) {
 	versions := []Version{}
 	for _, v := range e.Versions {
@@ -111,3 +111,86 @@ func TestKeepVersions(t *testing.T) {
 		}
 	}
 }
+
+func TestBadges(t *testing.T) {
+	e := Extension{Flags: "validated, public, preview", Publisher: Publisher{Flags: "verified"}}
+	if !e.IsPreview() {
+		t.Error("expected extension to be preview")
+	}
+	if !e.Publisher.IsVerified() {
+		t.Error("expected publisher to be verified")
+	}
+	e = Extension{Flags: "validated, public", Publisher: Publisher{Flags: "none"}}
+	if e.IsPreview() {
+		t.Error("did not expect extension to be preview")
+	}
+	if e.Publisher.IsVerified() {
+		t.Error("did not expect publisher to be verified")
+	}
+}
+
+func TestLatestVersionForPlatform(t *testing.T) {
+	e := Extension{
+		Versions: []Version{
+			{Version: "3.0", RawTargetPlatform: "linux-x64", Properties: []Property{{Key: "Microsoft.VisualStudio.Code.PreRelease", Value: "true"}}},
+			{Version: "2.0", RawTargetPlatform: "darwin-arm64"},
+			{Version: "2.0", RawTargetPlatform: "linux-x64"},
+			{Version: "1.0", RawTargetPlatform: "linux-x64"},
+		},
+	}
+	if got := len(e.VersionsForPlatform("linux-x64")); got != 3 {
+		t.Errorf("expected 3 linux-x64 versions, got %v", got)
+	}
+	if got := e.LatestVersionForPlatform("linux-x64", false); got != "2.0" {
+		t.Errorf("expected 2.0, got %v", got)
+	}
+	if got := e.LatestVersionForPlatform("linux-x64", true); got != "3.0" {
+		t.Errorf("expected 3.0, got %v", got)
+	}
+	if got := e.LatestVersionForPlatform("win32-x64", true); got != "" {
+		t.Errorf("expected no version, got %v", got)
+	}
+}
+
+func TestLatestVersionPreReleaseOnly(t *testing.T) {
+	preRelease := []Property{{Key: "Microsoft.VisualStudio.Code.PreRelease", Value: "true"}}
+	e := Extension{
+		Versions: []Version{
+			{Version: "0.3.0", Properties: preRelease},
+			{Version: "0.2.0", Properties: preRelease},
+		},
+	}
+	if got := e.LatestVersion(true); got != "0.3.0" {
+		t.Errorf("expected 0.3.0, got %v", got)
+	}
+	if got := e.LatestVersion(false); got != "" {
+		t.Errorf("expected no stable version, got %v", got)
+	}
+}
+
+func TestHasTag(t *testing.T) {
+	e := Extension{Tags: []string{"keybindings", "Snippet"}}
+	if !e.HasTag("KeyBindings") {
+		t.Error("expected extension to have tag keybindings")
+	}
+	if !e.HasTag("snippet") {
+		t.Error("expected extension to have tag snippet")
+	}
+	if e.HasTag("key") {
+		t.Error("did not expect partial tag key to match")
+	}
+}
+
+func TestHash(t *testing.T) {
+	e := Extension{Name: "go", Publisher: Publisher{Name: "golang"}, Versions: []Version{{Version: "1.0.0"}}}
+	moved := e
+	moved.Path = "/somewhere/else"
+	if e.Hash() != moved.Hash() {
+		t.Error("expected path not to change the hash")
+	}
+	changed := e.Copy()
+	changed.Versions[0].Version = "1.0.1"
+	if e.Hash() == changed.Hash() {
+		t.Error("expected changed version to change the hash")
+	}
+}
@@ -0,0 +1,69 @@
+package vscode
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// targetPlatforms are the target platforms supported by Visual Studio Code.
+var targetPlatforms = []string{
+	"alpine-arm64",
+	"alpine-x64",
+	"darwin-arm64",
+	"darwin-x64",
+	"linux-arm64",
+	"linux-armhf",
+	"linux-x64",
+	PlatformUniversal,
+	"web",
+	"win32-arm64",
+	"win32-ia32",
+	"win32-x64",
+}
+
+// platformGroups are shortcuts for all target platforms of an operating system.
+var platformGroups = map[string][]string{
+	"alpine": {"alpine-x64", "alpine-arm64"},
+	"darwin": {"darwin-x64", "darwin-arm64"},
+	"linux":  {"linux-x64", "linux-arm64", "linux-armhf"},
+	"win32":  {"win32-x64", "win32-arm64", "win32-ia32"},
+}
+
+// PlatformGroups returns the names of the platform groups accepted by ParseTargetPlatforms.
+func PlatformGroups() []string {
+	names := []string{}
+	for name := range platformGroups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// TargetPlatforms returns all target platforms supported by Visual Studio Code.
+func TargetPlatforms() []string {
+	return slices.Clone(targetPlatforms)
+}
+
+// ParseTargetPlatforms validates the given target platforms and returns them in lower case.
+// Platform groups, like linux, are expanded to all target platforms in the group. An error
+// is returned if a platform is not supported by Visual Studio Code.
+func ParseTargetPlatforms(names []string) ([]string, error) {
+	platforms := []string{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		expanded, found := platformGroups[name]
+		if !found {
+			if !slices.Contains(targetPlatforms, name) {
+				return platforms, fmt.Errorf("%s is not a valid target platform, valid platforms are: %s", name, strings.Join(append(targetPlatforms, PlatformGroups()...), ", "))
+			}
+			expanded = []string{name}
+		}
+		for _, p := range expanded {
+			if !slices.Contains(platforms, p) {
+				platforms = append(platforms, p)
+			}
+		}
+	}
+	return platforms, nil
+}
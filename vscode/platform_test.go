@@ -0,0 +1,28 @@
+package vscode
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTargetPlatforms(t *testing.T) {
+	platforms, err := ParseTargetPlatforms([]string{"linux-x64", "Darwin-ARM64", "universal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"linux-x64", "darwin-arm64", "universal"}
+	if !slices.Equal(platforms, expected) {
+		t.Errorf("expected %v but got %v", expected, platforms)
+	}
+	platforms, err = ParseTargetPlatforms([]string{"linux", "linux-x64", "darwin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"linux-x64", "linux-arm64", "linux-armhf", "darwin-x64", "darwin-arm64"}
+	if !slices.Equal(platforms, expected) {
+		t.Errorf("expected %v but got %v", expected, platforms)
+	}
+	if _, err := ParseTargetPlatforms([]string{"linux-x86"}); err == nil {
+		t.Error("expected error for invalid target platform")
+	}
+}
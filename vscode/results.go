@@ -46,6 +46,22 @@ func NewResults() Results {
 	}
 }
 
+// TotalCount returns the total number of extensions matching a query, from the result
+// metadata of a query result. False is returned if the metadata has no total count.
+func TotalCount(metadata []ResultMetadata) (int, bool) {
+	for _, md := range metadata {
+		if md.MetadataType != "ResultCount" {
+			continue
+		}
+		for _, item := range md.MetadataItems {
+			if item.Name == "TotalCount" {
+				return item.Count, true
+			}
+		}
+	}
+	return 0, false
+}
+
 func (r Results) SetTotalCount(v int) {
 	r.Results[0].ResultMetadata[0].MetadataItems[0].Count = v
 }
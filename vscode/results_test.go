@@ -63,3 +63,43 @@ func Test_AddExtensions(t *testing.T) {
 		}
 	}
 }
+
+func TestSetAssetEndpointOnCopies(t *testing.T) {
+	ext := Extension{
+		ID: "1",
+		Versions: []Version{
+			{Version: "1.0", Files: []Asset{{Source: "/a/b/1.0/vsix"}}},
+		},
+	}
+	r1 := NewResults()
+	r1.AddExtensions([]Extension{ext.Copy()})
+	r2 := NewResults()
+	r2.AddExtensions([]Extension{ext.Copy()})
+
+	r1.SetAssetEndpoint("http://one")
+	r2.SetAssetEndpoint("http://two")
+
+	if got := ext.Versions[0].Files[0].Source; got != "/a/b/1.0/vsix" {
+		t.Errorf("expected original source to be unchanged, got %v", got)
+	}
+	if got := r1.Results[0].Extensions[0].Versions[0].Files[0].Source; got != "http://one/a/b/1.0/vsix" {
+		t.Errorf("expected http://one/a/b/1.0/vsix, got %v", got)
+	}
+	if got := r2.Results[0].Extensions[0].Versions[0].Files[0].Source; got != "http://two/a/b/1.0/vsix" {
+		t.Errorf("expected http://two/a/b/1.0/vsix, got %v", got)
+	}
+	if got := r2.Results[0].Extensions[0].Versions[0].AssetURI; got != "http://two/a/b/1.0" {
+		t.Errorf("expected asset URI http://two/a/b/1.0, got %v", got)
+	}
+}
+
+func TestTotalCount(t *testing.T) {
+	res := NewResults()
+	res.SetTotalCount(42)
+	if count, found := TotalCount(res.Results[0].ResultMetadata); !found || count != 42 {
+		t.Errorf("expected total count 42, got %v (found %v)", count, found)
+	}
+	if _, found := TotalCount([]ResultMetadata{{MetadataType: "Categories"}}); found {
+		t.Error("expected no total count in metadata without result count")
+	}
+}